@@ -0,0 +1,301 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Broadcast is a message to everyone booked on one workshop, e.g. a room change
+type Broadcast struct {
+	ID             int
+	WorkshopID     int
+	Subject        string
+	Body           string
+	IncludePending bool
+	Recipients     int
+	Sent           int
+	Failed         int
+	CreatedAt      string
+}
+
+// broadcastPlaceholders are replaced per recipient in subject and body
+var broadcastPlaceholders = []string{
+	"{first_name}", "{last_name}", "{workshop_title}", "{workshop_date}", "{workshop_location}",
+}
+
+func fillBroadcastPlaceholders(text string, signup Signup, workshop Workshop) string {
+	return strings.NewReplacer(
+		"{first_name}", signup.FirstName,
+		"{last_name}", signup.LastName,
+		"{workshop_title}", workshop.Title,
+		"{workshop_date}", workshop.Date,
+		"{workshop_location}", workshop.Location,
+	).Replace(text)
+}
+
+func (h *Handlers) loadBroadcastWorkshop(c *gin.Context) (Workshop, bool) {
+	var w Workshop
+	err := h.db.QueryRow(`
+        SELECT id, title, date, location FROM workshops WHERE id = ?
+    `, c.Param("id")).Scan(&w.ID, &w.Title, &w.Date, &w.Location)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return w, false
+	}
+	if err != nil {
+		log.Printf("Error loading workshop %s: %v", c.Param("id"), err)
+		c.String(http.StatusInternalServerError, "Error loading workshop: %v", err)
+		return w, false
+	}
+	return w, true
+}
+
+// BroadcastHandler shows the composer and earlier messages for a workshop
+func (h *Handlers) BroadcastHandler(c *gin.Context) {
+	workshop, ok := h.loadBroadcastWorkshop(c)
+	if !ok {
+		return
+	}
+
+	var confirmed, pending int
+	h.db.QueryRow(`
+        SELECT COALESCE(SUM(status = 'confirmed'), 0),
+               COALESCE(SUM(status = 'pending_payment' AND hold_expires_at > datetime('now')), 0)
+        FROM signups WHERE workshop_id = ?
+    `, workshop.ID).Scan(&confirmed, &pending)
+
+	rows, err := h.db.Query(`
+        SELECT b.id, b.subject, b.include_pending, b.recipients, b.created_at,
+               COALESCE(SUM(o.status = 'sent'), 0), COALESCE(SUM(o.status = 'failed'), 0)
+        FROM broadcasts b
+        LEFT JOIN email_outbox o ON o.kind = 'broadcast' AND o.reference_id = b.id
+        WHERE b.workshop_id = ?
+        GROUP BY b.id
+        ORDER BY b.created_at DESC
+    `, workshop.ID)
+	if err != nil {
+		log.Printf("Error loading broadcasts: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading broadcasts: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var broadcasts []Broadcast
+	for rows.Next() {
+		var b Broadcast
+		err := rows.Scan(&b.ID, &b.Subject, &b.IncludePending, &b.Recipients, &b.CreatedAt, &b.Sent, &b.Failed)
+		if err != nil {
+			log.Printf("Error scanning broadcast row: %v", err)
+			continue
+		}
+		broadcasts = append(broadcasts, b)
+	}
+
+	c.HTML(http.StatusOK, "broadcast.html", gin.H{
+		"Workshop":     workshop,
+		"Confirmed":    confirmed,
+		"Pending":      pending,
+		"Broadcasts":   broadcasts,
+		"Placeholders": broadcastPlaceholders,
+		"Queued":       c.Query("queued"),
+		"Error":        c.Query("broadcast_error"),
+		"EmailEnabled": emailConfigured(),
+	})
+}
+
+// SendBroadcastHandler queues one personalised email per recipient. They go
+// ahead of newsletters in the outbox since they're usually time critical.
+func (h *Handlers) SendBroadcastHandler(c *gin.Context) {
+	workshop, ok := h.loadBroadcastWorkshop(c)
+	if !ok {
+		return
+	}
+	back := fmt.Sprintf("/admin/workshops/%d/broadcast", workshop.ID)
+
+	var form struct {
+		Subject        string `form:"subject" binding:"required,max=200"`
+		Body           string `form:"body" binding:"required"`
+		IncludePending bool   `form:"include_pending"`
+	}
+	if err := c.ShouldBind(&form); err != nil {
+		c.Redirect(http.StatusSeeOther, back+"?broadcast_error="+url.QueryEscape("Please fill in subject and message"))
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting broadcast transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending message"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Seats still waiting for payment are included on request
+	rows, err := tx.Query(`
+        SELECT id, first_name, last_name, email FROM signups
+        WHERE workshop_id = ? AND anonymized_at IS NULL
+          AND (status = 'confirmed'
+               OR (? AND status = 'pending_payment' AND hold_expires_at > datetime('now')))
+        ORDER BY id
+    `, workshop.ID, form.IncludePending)
+	if err != nil {
+		log.Printf("Error loading broadcast recipients: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending message"})
+		return
+	}
+	var recipients []Signup
+	for rows.Next() {
+		var s Signup
+		if err := rows.Scan(&s.ID, &s.FirstName, &s.LastName, &s.Email); err == nil {
+			recipients = append(recipients, s)
+		}
+	}
+	rows.Close()
+
+	if len(recipients) == 0 {
+		c.Redirect(http.StatusSeeOther, back+"?broadcast_error="+url.QueryEscape("This workshop has no participants to write to"))
+		return
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO broadcasts (workshop_id, subject, body, include_pending, recipients)
+        VALUES (?, ?, ?, ?, ?)
+    `, workshop.ID, form.Subject, form.Body, form.IncludePending, len(recipients))
+	if err != nil {
+		log.Printf("Error saving broadcast: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending message"})
+		return
+	}
+	broadcastID, _ := result.LastInsertId()
+
+	body := strings.ReplaceAll(form.Body, "\r\n", "\n")
+	for _, signup := range recipients {
+		err := queueEmail(tx, OutboxMessage{
+			ToEmail:     signup.Email,
+			Subject:     fillBroadcastPlaceholders(form.Subject, signup, workshop),
+			TextBody:    fillBroadcastPlaceholders(body, signup, workshop),
+			Kind:        "broadcast",
+			ReferenceID: int(broadcastID),
+			SignupID:    signup.ID,
+			Priority:    1,
+		})
+		if err != nil {
+			log.Printf("Error queueing broadcast: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending message"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing broadcast: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending message"})
+		return
+	}
+
+	log.Printf("✓ Broadcast %d queued for %d participants of workshop %d", broadcastID, len(recipients), workshop.ID)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/broadcasts/%d?queued=%d", broadcastID, len(recipients)))
+}
+
+// BroadcastStatusHandler lists the delivery status of every recipient
+func (h *Handlers) BroadcastStatusHandler(c *gin.Context) {
+	broadcastID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Message not found")
+		return
+	}
+
+	var b Broadcast
+	var workshop Workshop
+	err = h.db.QueryRow(`
+        SELECT b.id, b.subject, b.body, b.include_pending, b.recipients, b.created_at,
+               w.id, w.title, w.date
+        FROM broadcasts b
+        JOIN workshops w ON w.id = b.workshop_id
+        WHERE b.id = ?
+    `, broadcastID).Scan(&b.ID, &b.Subject, &b.Body, &b.IncludePending, &b.Recipients, &b.CreatedAt,
+		&workshop.ID, &workshop.Title, &workshop.Date)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading broadcast %d: %v", broadcastID, err)
+		c.String(http.StatusInternalServerError, "Error loading message: %v", err)
+		return
+	}
+
+	rows, err := h.db.Query(`
+        SELECT o.id, o.to_email, o.status, o.attempts, COALESCE(o.last_error, ''),
+               COALESCE(o.sent_at, ''), COALESCE(s.first_name || ' ' || s.last_name, '')
+        FROM email_outbox o
+        LEFT JOIN signups s ON s.id = o.signup_id
+        WHERE o.kind = 'broadcast' AND o.reference_id = ?
+        ORDER BY o.id
+    `, broadcastID)
+	if err != nil {
+		log.Printf("Error loading broadcast deliveries: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading message: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type delivery struct {
+		Message OutboxMessage
+		Name    string
+	}
+	var deliveries []delivery
+	var failed int
+	for rows.Next() {
+		var d delivery
+		err := rows.Scan(&d.Message.ID, &d.Message.ToEmail, &d.Message.Status, &d.Message.Attempts,
+			&d.Message.LastError, &d.Message.SentAt, &d.Name)
+		if err != nil {
+			log.Printf("Error scanning delivery row: %v", err)
+			continue
+		}
+		if d.Message.Status == OutboxFailed {
+			failed++
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	c.HTML(http.StatusOK, "broadcast_status.html", gin.H{
+		"Broadcast":  b,
+		"Workshop":   workshop,
+		"Deliveries": deliveries,
+		"Failed":     failed,
+		"Queued":     c.Query("queued"),
+	})
+}
+
+// RetryBroadcastHandler puts failed deliveries back in the queue, e.g. after
+// fixing a typo in the participant's email address
+func (h *Handlers) RetryBroadcastHandler(c *gin.Context) {
+	broadcastID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Message not found")
+		return
+	}
+
+	// Pick up corrected addresses from the signup
+	_, err = h.db.Exec(`
+        UPDATE email_outbox
+        SET status = 'queued', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP,
+            to_email = COALESCE((SELECT email FROM signups WHERE id = email_outbox.signup_id), to_email)
+        WHERE kind = 'broadcast' AND reference_id = ? AND status = 'failed'
+    `, broadcastID)
+	if err != nil {
+		log.Printf("Error retrying broadcast %d: %v", broadcastID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrying message"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/broadcasts/%d", broadcastID))
+}
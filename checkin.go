@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const checkinTokenPurpose = "checkin"
+
+var errInvalidCheckinCode = errors.New("invalid check-in code")
+
+// checkinURL is what the QR code in the confirmation email points to. Staff
+// can scan it with any phone camera and land on the check-in page.
+func (h *Handlers) checkinURL(c *gin.Context, signup Signup) string {
+	if signup.ID == 0 || signup.WorkshopID == 0 {
+		return ""
+	}
+	token := signToken(h.signingKey, checkinTokenPurpose, strconv.Itoa(signup.ID))
+	return fmt.Sprintf("%s/admin/checkin/%d?token=%s", baseURL(c), signup.WorkshopID, url.QueryEscape(token))
+}
+
+// resolveCheckinToken finds the confirmed signup for this workshop that a
+// scanned code belongs to. Course codes carry the first session's signup, so
+// they are matched to the same enrollment's signup for this session.
+func (h *Handlers) resolveCheckinToken(workshopID int, token string) (int, error) {
+	// Scanners hand us the whole URL, typed codes are just the token
+	if u, err := url.Parse(strings.TrimSpace(token)); err == nil && u.Query().Get("token") != "" {
+		token = u.Query().Get("token")
+	}
+
+	payload, ok := verifyToken(h.signingKey, checkinTokenPurpose, strings.TrimSpace(token))
+	if !ok {
+		return 0, errInvalidCheckinCode
+	}
+	ticketID, err := strconv.Atoi(payload)
+	if err != nil {
+		return 0, errInvalidCheckinCode
+	}
+
+	var signupID int
+	err = h.db.QueryRow(`
+        SELECT s.id FROM signups s
+        JOIN signups ticket ON ticket.id = ?
+        WHERE s.workshop_id = ? AND s.status = 'confirmed'
+          AND (s.id = ticket.id OR s.course_enrollment_id = ticket.course_enrollment_id)
+    `, ticketID, workshopID).Scan(&signupID)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("this code is not for a confirmed signup of this workshop")
+	}
+	return signupID, err
+}
+
+// attendanceCounts counts confirmed participants, how many were checked in
+// and, once the workshop has started, how many didn't show up. Groups check
+// in together, so every seat of a booking counts.
+func attendanceCounts(q queryRower, workshopID int) (Attendance, error) {
+	var a Attendance
+	err := q.QueryRow(`
+        SELECT COALESCE(SUM(s.seats), 0),
+               COALESCE(SUM(CASE WHEN s.attended_at IS NOT NULL THEN s.seats ELSE 0 END), 0),
+               COALESCE(SUM(CASE WHEN s.attended_at IS NULL AND w.starts_at <= ? THEN s.seats ELSE 0 END), 0)
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.workshop_id = ? AND s.status = 'confirmed'
+    `, time.Now().Format(startsAtLayout), workshopID).Scan(&a.Confirmed, &a.Attended, &a.NoShows)
+	return a, err
+}
+
+// formatCheckinTime shows a stored attended_at as local time of day
+func formatCheckinTime(attendedAt string) string {
+	t, err := parseDBTime(attendedAt)
+	if err != nil {
+		return attendedAt
+	}
+	return t.Local().Format("15:04")
+}
+
+// CheckinHandler is the door list: search or scan participants and mark them
+// present. Built for phones.
+func (h *Handlers) CheckinHandler(c *gin.Context) {
+	workshopID, err := strconv.Atoi(c.Param("workshopID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+
+	var workshop Workshop
+	err = h.db.QueryRow(`
+        SELECT id, title, date FROM workshops WHERE id = ?
+    `, workshopID).Scan(&workshop.ID, &workshop.Title, &workshop.Date)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading workshop %d: %v", workshopID, err)
+		c.String(http.StatusInternalServerError, "Error loading workshop: %v", err)
+		return
+	}
+
+	checkinError := c.Query("checkin_error")
+
+	// Codes scanned with the phone's own camera app open this page directly
+	var scannedID int
+	if token := c.Query("token"); token != "" {
+		scannedID, err = h.resolveCheckinToken(workshopID, token)
+		if err != nil {
+			checkinError = err.Error()
+		}
+	}
+	if id, err := strconv.Atoi(c.Query("checked_in")); err == nil {
+		scannedID = id
+	}
+
+	search := strings.TrimSpace(c.Query("q"))
+	like := "%" + search + "%"
+	rows, err := h.db.Query(`
+        SELECT id, first_name, last_name, email, seats, COALESCE(attended_at, '')
+        FROM signups
+        WHERE workshop_id = ? AND status = 'confirmed'
+          AND (? = '' OR first_name || ' ' || last_name LIKE ? OR email LIKE ?)
+        ORDER BY first_name COLLATE NOCASE, last_name COLLATE NOCASE
+    `, workshopID, search, like, like)
+	if err != nil {
+		log.Printf("Error querying check-in list: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading signups: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var signups []Signup
+	var scanned *Signup
+	for rows.Next() {
+		var s Signup
+		if err := rows.Scan(&s.ID, &s.FirstName, &s.LastName, &s.Email, &s.Seats, &s.AttendedAt); err != nil {
+			log.Printf("Error scanning check-in row: %v", err)
+			continue
+		}
+		s.AttendedAt = formatCheckinTime(s.AttendedAt)
+		if s.ID == scannedID {
+			scanned = &s
+		}
+		signups = append(signups, s)
+	}
+
+	if scanned != nil && scanned.Seats > 1 {
+		guests, err := h.loadGuests("s.id = ?", scanned.ID)
+		if err != nil {
+			log.Printf("Error loading guests: %v", err)
+		}
+		scanned.Guests = guests[scanned.ID]
+	}
+
+	attendance, err := attendanceCounts(h.db, workshopID)
+	if err != nil {
+		log.Printf("Error counting attendance: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "checkin.html", gin.H{
+		"Workshop":     workshop,
+		"Signups":      signups,
+		"Scanned":      scanned,
+		"Search":       search,
+		"Attendance":   attendance,
+		"CheckinError": checkinError,
+	})
+}
+
+// CheckinSubmitHandler marks a participant present, by scanned code or by
+// signup id from the list. attended=false undoes a check-in.
+func (h *Handlers) CheckinSubmitHandler(c *gin.Context) {
+	workshopID, err := strconv.Atoi(c.Param("workshopID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+
+	var form struct {
+		Token    string `form:"token"`
+		SignupID int    `form:"signup_id"`
+		Attended string `form:"attended"`
+		Search   string `form:"q"`
+	}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid check-in"})
+		return
+	}
+
+	back := fmt.Sprintf("/admin/checkin/%d", workshopID)
+	query := url.Values{}
+	if form.Search != "" {
+		query.Set("q", form.Search)
+	}
+
+	signupID := form.SignupID
+	if form.Token != "" {
+		signupID, err = h.resolveCheckinToken(workshopID, form.Token)
+		if err != nil {
+			query.Set("checkin_error", err.Error())
+			c.Redirect(http.StatusSeeOther, back+"?"+query.Encode())
+			return
+		}
+	}
+
+	// Checking in twice keeps the first arrival time
+	var result sql.Result
+	if form.Attended == "false" {
+		result, err = h.db.Exec(`
+            UPDATE signups SET attended_at = NULL
+            WHERE id = ? AND workshop_id = ?
+        `, signupID, workshopID)
+	} else {
+		result, err = h.db.Exec(`
+            UPDATE signups SET attended_at = COALESCE(attended_at, ?)
+            WHERE id = ? AND workshop_id = ? AND status = 'confirmed'
+        `, time.Now().UTC().Format(sqliteTimeLayout), signupID, workshopID)
+	}
+	if err != nil {
+		log.Printf("Error saving check-in: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving check-in"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		query.Set("checkin_error", "Signup not found for this workshop")
+	} else {
+		query.Set("checked_in", strconv.Itoa(signupID))
+	}
+
+	c.Redirect(http.StatusSeeOther, back+"?"+query.Encode())
+}
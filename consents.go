@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConsentPolicy is a checkbox on the signup form, e.g. the privacy policy.
+// Bump the version whenever the linked text changes, signups keep the
+// version they agreed to.
+type ConsentPolicy struct {
+	ID        int
+	Name      string // short, for the admin panel and exports
+	Label     string // the text next to the checkbox
+	URL       string
+	Version   string
+	Required  bool
+	Active    bool
+	UpdatedAt string
+}
+
+// SignupConsent is what one signup answered to one policy
+type SignupConsent struct {
+	PolicyID   int    `json:"policy_id"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Accepted   bool   `json:"accepted"`
+	RecordedAt string `json:"recorded_at"`
+}
+
+func (sc SignupConsent) String() string {
+	answer := "no"
+	if sc.Accepted {
+		answer = "yes"
+	}
+	return fmt.Sprintf("%s v%s: %s", sc.Name, sc.Version, answer)
+}
+
+// defaultConsentPolicies are created on first start, the studio adds links
+// to its own texts in the admin panel
+var defaultConsentPolicies = []ConsentPolicy{
+	{Name: "Privacy policy", Label: "I have read and accept the privacy policy", Version: "1", Required: true},
+	{Name: "Liability waiver", Label: "I take part at my own risk and will tell the teacher about injuries or health conditions", Version: "1", Required: true},
+	{Name: "Photo consent", Label: "Photos of me taken during the workshop may be used on the website and social media", Version: "1"},
+}
+
+func seedConsentPolicies(db *sql.DB) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM consent_policies").Scan(&count); err != nil {
+		log.Fatal(err)
+	}
+	if count > 0 {
+		return
+	}
+
+	for _, p := range defaultConsentPolicies {
+		_, err := db.Exec(`
+            INSERT INTO consent_policies (name, label, url, version, required) VALUES (?, ?, ?, ?, ?)
+        `, p.Name, p.Label, p.URL, p.Version, p.Required)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Println("✓ Default consent checkboxes created")
+}
+
+func (h *Handlers) consentPolicies(activeOnly bool) ([]ConsentPolicy, error) {
+	rows, err := h.db.Query(`
+        SELECT id, name, label, COALESCE(url, ''), version, required, active, updated_at
+        FROM consent_policies
+        WHERE active OR NOT ?
+        ORDER BY active DESC, id
+    `, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []ConsentPolicy
+	for rows.Next() {
+		var p ConsentPolicy
+		if err := rows.Scan(&p.ID, &p.Name, &p.Label, &p.URL, &p.Version, &p.Required, &p.Active, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// consentsFromForm reads the checkboxes and returns the answers to record.
+// Required boxes that weren't ticked are added to errs, in lang.
+func consentsFromForm(c *gin.Context, policies []ConsentPolicy, lang string, errs FormErrors) []SignupConsent {
+	var consents []SignupConsent
+	for _, p := range policies {
+		field := fmt.Sprintf("consent_%d", p.ID)
+		accepted := c.PostForm(field) == "true"
+		if p.Required && !accepted {
+			errs.Add(field, translate(lang, "error.confirm", p.Name))
+		}
+		consents = append(consents, SignupConsent{
+			PolicyID: p.ID,
+			Name:     p.Name,
+			Version:  p.Version,
+			Accepted: accepted,
+		})
+	}
+	return consents
+}
+
+func recordConsents(db execer, signupID int64, consents []SignupConsent) error {
+	for _, sc := range consents {
+		_, err := db.Exec(`
+            INSERT INTO signup_consents (signup_id, policy_id, name, version, accepted)
+            VALUES (?, ?, ?, ?, ?)
+        `, signupID, sc.PolicyID, sc.Name, sc.Version, sc.Accepted)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConsents returns the recorded answers by signup ID. The condition may
+// use s for signups and w for workshops.
+func (h *Handlers) loadConsents(condition string, args ...any) (map[int][]SignupConsent, error) {
+	rows, err := h.db.Query(`
+        SELECT sc.signup_id, sc.policy_id, sc.name, sc.version, sc.accepted, sc.recorded_at
+        FROM signup_consents sc
+        JOIN signups s ON s.id = sc.signup_id
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE `+condition+`
+        ORDER BY sc.signup_id, sc.policy_id
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := make(map[int][]SignupConsent)
+	for rows.Next() {
+		var signupID int
+		var sc SignupConsent
+		if err := rows.Scan(&signupID, &sc.PolicyID, &sc.Name, &sc.Version, &sc.Accepted, &sc.RecordedAt); err != nil {
+			return nil, err
+		}
+		consents[signupID] = append(consents[signupID], sc)
+	}
+	return consents, rows.Err()
+}
+
+type consentPolicyForm struct {
+	Name     string `form:"name" binding:"required,max=50"`
+	Label    string `form:"label" binding:"required,max=300"`
+	URL      string `form:"url" binding:"omitempty,url"`
+	Version  string `form:"version" binding:"required,max=20"`
+	Required bool   `form:"required"`
+	Active   bool   `form:"active"`
+}
+
+func consentsRedirect(c *gin.Context, message string) {
+	target := "/admin/consents"
+	if message != "" {
+		target += "?consent_error=" + url.QueryEscape(message)
+	}
+	c.Redirect(http.StatusSeeOther, target)
+}
+
+// AdminConsentsHandler lists the checkboxes shown on the signup forms
+func (h *Handlers) AdminConsentsHandler(c *gin.Context) {
+	policies, err := h.consentPolicies(false)
+	if err != nil {
+		log.Printf("Error loading consent policies: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading consents: %v", err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "admin_consents.html", gin.H{
+		"Policies": policies,
+		"Error":    c.Query("consent_error"),
+	})
+}
+
+func (h *Handlers) CreateConsentPolicyHandler(c *gin.Context) {
+	var form consentPolicyForm
+	if err := c.ShouldBind(&form); err != nil {
+		consentsRedirect(c, "Please enter a name, a label, a version and a valid link")
+		return
+	}
+
+	_, err := h.db.Exec(`
+        INSERT INTO consent_policies (name, label, url, version, required) VALUES (?, ?, ?, ?, ?)
+    `, form.Name, form.Label, form.URL, form.Version, form.Required)
+	if err != nil {
+		log.Printf("Error creating consent policy: %v", err)
+		consentsRedirect(c, "Could not save the checkbox")
+		return
+	}
+	consentsRedirect(c, "")
+}
+
+// UpdateConsentPolicyHandler changes a checkbox. Answers already given keep
+// the name and version they were recorded with.
+func (h *Handlers) UpdateConsentPolicyHandler(c *gin.Context) {
+	var form consentPolicyForm
+	if err := c.ShouldBind(&form); err != nil {
+		consentsRedirect(c, "Please enter a name, a label, a version and a valid link")
+		return
+	}
+
+	result, err := h.db.Exec(`
+        UPDATE consent_policies
+        SET name = ?, label = ?, url = ?, version = ?, required = ?, active = ?,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = ?
+    `, form.Name, form.Label, form.URL, form.Version, form.Required, form.Active, c.Param("id"))
+	if err != nil {
+		log.Printf("Error updating consent policy: %v", err)
+		consentsRedirect(c, "Could not save the checkbox")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		consentsRedirect(c, "No such checkbox")
+		return
+	}
+	consentsRedirect(c, "")
+}
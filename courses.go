@@ -0,0 +1,607 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// enrolledCourseSignups lists the enrollments holding seats right now, unpaid
+// holds that ran out don't count
+const enrolledCourseSignups = `(SELECT course_enrollment_id FROM signups WHERE ` + seatTakenCondition + `)`
+
+// loadCourse returns a course with its sessions in date order and the seats
+// taken in each
+func loadCourse(db *sql.DB, courseID int) (Course, error) {
+	var course Course
+	err := db.QueryRow(`
+        SELECT id, title, COALESCE(description, ''), COALESCE(location, ''), max_capacity,
+               price_cents, currency,
+               (SELECT COUNT(*) FROM course_enrollments
+                WHERE course_id = courses.id AND id IN `+enrolledCourseSignups+`)
+        FROM courses
+        WHERE id = ?
+    `, courseID).Scan(&course.ID, &course.Title, &course.Description, &course.Location,
+		&course.MaxCapacity, &course.PriceCents, &course.Currency, &course.Enrolled)
+	if err != nil {
+		return course, err
+	}
+
+	rows, err := db.Query(`
+        SELECT id, title, date, location, max_capacity, starts_at
+        FROM workshops
+        WHERE course_id = ?
+        ORDER BY starts_at ASC
+    `, courseID)
+	if err != nil {
+		return course, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		w := Workshop{CourseID: courseID}
+		if err := rows.Scan(&w.ID, &w.Title, &w.Date, &w.Location, &w.MaxCapacity, &w.StartsAt); err != nil {
+			return course, err
+		}
+		course.Sessions = append(course.Sessions, w)
+	}
+	if err := rows.Err(); err != nil {
+		return course, err
+	}
+
+	for i := range course.Sessions {
+		course.Sessions[i].SignupCount, err = seatsTaken(db, course.Sessions[i].ID)
+		if err != nil {
+			return course, err
+		}
+	}
+
+	return course, nil
+}
+
+// courseSessionDates lists the session dates for emails, one per line
+func courseSessionDates(course Course, lang string) string {
+	dates := make([]string, len(course.Sessions))
+	for i, s := range course.Sessions {
+		dates[i] = workshopDate(s, lang)
+	}
+	return strings.Join(dates, "\n  ")
+}
+
+// sendCourseEmails is sendSignupEmails for a whole course, the emails list
+// every session
+func (h *Handlers) sendCourseEmails(c *gin.Context, signup Signup, course Course) {
+	ctx := c.Request.Context()
+	go sendSignupNotification(ctx, signup, course.Title, courseSessionDates(course, defaultLanguage()))
+	go sendConfirmationEmail(ctx, signup, course.Title, courseSessionDates(course, signup.Language),
+		course.Location, h.checkinURL(c, signup))
+}
+
+// releaseCourseHolds gives back the other sessions' seats once the signup
+// paying for a course enrollment lost its hold
+func releaseCourseHolds(db execer, signupID int) error {
+	_, err := db.Exec(`
+        UPDATE signups SET status = 'expired'
+        WHERE status = 'pending_payment'
+          AND course_enrollment_id = (SELECT course_enrollment_id FROM signups WHERE id = ?)
+    `, signupID)
+	return err
+}
+
+// courseNotFound shows the "no workshop" page for unknown courses
+func courseNotFound(c *gin.Context, lang string) {
+	c.HTML(http.StatusNotFound, "no_workshop.html", gin.H{
+		"Lang":      lang,
+		"Languages": languageOptions(lang),
+	})
+}
+
+func (h *Handlers) CourseHandler(c *gin.Context) {
+	lang := requestLanguage(c)
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		courseNotFound(c, lang)
+		return
+	}
+
+	course, err := loadCourse(h.db, courseID)
+	if err != nil {
+		courseNotFound(c, lang)
+		return
+	}
+
+	policies, err := h.consentPolicies(true)
+	if err != nil {
+		log.Printf("Error loading consent policies: %v", err)
+	}
+
+	page := h.coursePage(lang, course, policies)
+	page["Success"] = c.Query("success") == "true"
+	c.HTML(http.StatusOK, "course.html", page)
+}
+
+// coursePage is what course.html needs, with the session dates in lang
+func (h *Handlers) coursePage(lang string, course Course, policies []ConsentPolicy) gin.H {
+	sessions := make([]Workshop, len(course.Sessions))
+	for i, s := range course.Sessions {
+		s.Date = workshopDate(s, lang)
+		sessions[i] = s
+	}
+	course.Sessions = sessions
+
+	return gin.H{
+		"Lang":            lang,
+		"Languages":       languageOptionsFor(fmt.Sprintf("/courses/%d", course.ID), lang),
+		"Course":          course,
+		"ConsentPolicies": policies,
+		"PayOnline":       course.IsPaid() && h.stripe != nil,
+		"Spam":            h.spamFields(),
+	}
+}
+
+// courseFormError shows the course form again with what was entered and
+// what's wrong with it
+func (h *Handlers) courseFormError(c *gin.Context, status int, lang string, course Course,
+	policies []ConsentPolicy, errs FormErrors) {
+	page := h.coursePage(lang, course, policies)
+	page["Form"] = formValues(c)
+	page["Errors"] = errs
+	page["Error"] = errs.Message(lang)
+	c.HTML(status, "course.html", page)
+}
+
+// CourseSignupHandler registers one person for every session of a course.
+// Either all sessions get a seat or none do.
+func (h *Handlers) CourseSignupHandler(c *gin.Context) {
+	lang := normalizeLanguage(c.PostForm("lang"))
+	if lang == "" {
+		lang = requestLanguage(c)
+	}
+
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		courseNotFound(c, lang)
+		return
+	}
+
+	course, err := loadCourse(h.db, courseID)
+	if err != nil {
+		courseNotFound(c, lang)
+		return
+	}
+
+	outcome := signupError
+	defer countSignup("course", &outcome)
+
+	policies, err := h.consentPolicies(true)
+	if err != nil {
+		log.Printf("Error loading consent policies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+
+	var form CourseSignupForm
+	errs := FormErrors{}
+	if err := c.ShouldBind(&form); err != nil {
+		errs = bindErrors(&form, err, lang)
+	}
+
+	fullPhone, err := normalizePhone(c.PostForm("country_code"), form.Phone)
+	if err != nil {
+		errs.Add("phone", translate(lang, "error.phone_invalid"))
+	}
+
+	if reason := h.checkSpam(c, "course signup", form.Email); reason != "" {
+		outcome = signupSpam
+		if reason == spamHoneypot {
+			c.Redirect(http.StatusSeeOther, fmt.Sprintf("/courses/%d?success=true", courseID))
+			return
+		}
+		h.courseFormError(c, reason.Status(), lang, course, policies,
+			FormErrors{"": translate(lang, reason.MessageKey())})
+		return
+	}
+
+	consents := consentsFromForm(c, policies, lang, errs)
+	if len(errs) > 0 {
+		outcome = signupValidationError
+		h.courseFormError(c, http.StatusBadRequest, lang, course, policies, errs)
+		return
+	}
+
+	if len(course.Sessions) == 0 {
+		outcome = signupValidationError
+		h.courseFormError(c, http.StatusBadRequest, lang, course, policies,
+			FormErrors{"": translate(lang, "error.course_no_sessions")})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting course signup transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	defer tx.Rollback()
+
+	var enrolled int
+	err = tx.QueryRow(`
+        SELECT COUNT(*) FROM course_enrollments WHERE course_id = ? AND id IN `+enrolledCourseSignups,
+		courseID).Scan(&enrolled)
+	if err != nil {
+		log.Printf("Error counting enrollments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+
+	full := enrolled >= course.MaxCapacity
+	for _, session := range course.Sessions {
+		taken, err := seatsTaken(tx, session.ID)
+		if err != nil {
+			log.Printf("Error counting seats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+			return
+		}
+		if taken >= session.MaxCapacity {
+			full = true
+		}
+	}
+	if full {
+		outcome = signupFull
+		h.courseFormError(c, http.StatusConflict, lang, course, policies,
+			FormErrors{"": translate(lang, "error.course_full")})
+		return
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO course_enrollments (course_id, first_name, last_name, email, phone)
+        VALUES (?, ?, ?, ?, ?)
+    `, courseID, form.FirstName, form.LastName, form.Email, fullPhone)
+	if err != nil {
+		log.Printf("Error inserting course enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	enrollmentID, _ := result.LastInsertId()
+
+	participantID, err := upsertParticipant(tx, form.FirstName, form.LastName, form.Email, fullPhone)
+	if err != nil {
+		log.Printf("Error saving participant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+
+	// Paid courses hold every session's seat until Stripe confirms the
+	// payment, like workshops. Without Stripe the fee is collected offline.
+	payOnline := course.IsPaid() && h.stripe != nil
+	status := SignupConfirmed
+	var holdExpiresAt time.Time
+	var holdUntil any
+	if payOnline {
+		status = SignupPendingPayment
+		holdExpiresAt = time.Now().UTC().Add(h.holdDuration)
+		holdUntil = holdExpiresAt.Format(sqliteTimeLayout)
+	}
+
+	// The first session's signup stands in for the whole enrollment, e.g. in
+	// the check-in code of the confirmation email. It carries the course
+	// price, the other sessions cost nothing on their own.
+	var firstSignupID int64
+	for _, session := range course.Sessions {
+		priceCents := 0
+		if firstSignupID == 0 {
+			priceCents = course.PriceCents
+		}
+		paymentStatus := PaymentPending
+		if priceCents == 0 {
+			paymentStatus = PaymentPaid
+		}
+
+		result, err := tx.Exec(`
+            INSERT INTO signups (workshop_id, first_name, last_name, email, phone, status, hold_expires_at,
+                                 price_cents, payment_status, course_enrollment_id, participant_id, language)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `, session.ID, form.FirstName, form.LastName, form.Email, fullPhone, status, holdUntil,
+			priceCents, paymentStatus, enrollmentID, participantID, lang)
+		if err != nil {
+			log.Printf("Error inserting course session signup: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+			return
+		}
+		signupID, _ := result.LastInsertId()
+		if firstSignupID == 0 {
+			firstSignupID = signupID
+		}
+		if err := recordConsents(tx, signupID, consents); err != nil {
+			log.Printf("Error saving consents: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing course signup: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	outcome = signupSuccess
+
+	signup := Signup{
+		ID:         int(firstSignupID),
+		WorkshopID: course.Sessions[0].ID,
+		FirstName:  form.FirstName,
+		LastName:   form.LastName,
+		Email:      form.Email,
+		Phone:      fullPhone,
+		Status:     status,
+		Language:   lang,
+		PriceCents: course.PriceCents,
+		CreatedAt:  time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	// The emails go out once the payment is confirmed
+	if payOnline {
+		checkoutURL, err := h.createCheckout(c, signup, course.Title, course.Currency, holdExpiresAt)
+		if err != nil {
+			h.courseFormError(c, http.StatusBadGateway, lang, course, policies,
+				FormErrors{"": translate(lang, "error.payment_failed")})
+			return
+		}
+		c.Redirect(http.StatusSeeOther, checkoutURL)
+		return
+	}
+
+	h.sendCourseEmails(c, signup, course)
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/courses/%d?success=true", courseID))
+}
+
+func (h *Handlers) AdminCoursesHandler(c *gin.Context) {
+	rows, err := h.db.Query(`
+        SELECT c.id, c.title, c.max_capacity, c.price_cents, c.currency,
+               (SELECT COUNT(*) FROM course_enrollments
+                WHERE course_id = c.id AND id IN ` + enrolledCourseSignups + `),
+               (SELECT COUNT(*) FROM workshops WHERE course_id = c.id)
+        FROM courses c
+        ORDER BY c.created_at DESC
+    `)
+	if err != nil {
+		log.Printf("Error querying courses: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading courses: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type courseRow struct {
+		Course
+		SessionCount int
+	}
+
+	var courses []courseRow
+	for rows.Next() {
+		var row courseRow
+		if err := rows.Scan(&row.ID, &row.Title, &row.MaxCapacity, &row.PriceCents, &row.Currency,
+			&row.Enrolled, &row.SessionCount); err != nil {
+			log.Printf("Error scanning course row: %v", err)
+			continue
+		}
+		courses = append(courses, row)
+	}
+
+	c.HTML(http.StatusOK, "admin_courses.html", gin.H{
+		"Courses": courses,
+		"Error":   c.Query("error"),
+	})
+}
+
+// CreateCourseHandler creates a course and one workshop per session date
+func (h *Handlers) CreateCourseHandler(c *gin.Context) {
+	var form struct {
+		Title       string `form:"title" binding:"required"`
+		Description string `form:"description" binding:"required"`
+		Location    string `form:"location" binding:"required"`
+		MaxCapacity int    `form:"max_capacity" binding:"required,min=1"`
+		Price       string `form:"price"`
+		Currency    string `form:"currency" binding:"omitempty,oneof=CHF EUR"`
+		Sessions    string `form:"sessions" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&form); err != nil {
+		c.Redirect(http.StatusSeeOther, "/admin/courses?error=Please fill in all required fields")
+		return
+	}
+
+	priceCents, err := parsePriceCents(form.Price)
+	if err != nil {
+		c.Redirect(http.StatusSeeOther, "/admin/courses?error=Invalid price")
+		return
+	}
+	if form.Currency == "" {
+		form.Currency = "CHF"
+	}
+
+	// One "YYYY-MM-DD HH:MM" per line
+	var sessionTimes []time.Time
+	for _, line := range strings.Split(form.Sessions, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		startsAt, err := time.ParseInLocation(startsAtLayout, line, time.Local)
+		if err != nil {
+			c.Redirect(http.StatusSeeOther, "/admin/courses?error="+url.QueryEscape("Invalid session date: "+line))
+			return
+		}
+		sessionTimes = append(sessionTimes, startsAt)
+	}
+	if len(sessionTimes) == 0 {
+		c.Redirect(http.StatusSeeOther, "/admin/courses?error=Please add at least one session")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting course transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating course"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO courses (title, description, location, max_capacity, price_cents, currency)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, form.Title, form.Description, form.Location, form.MaxCapacity, priceCents, form.Currency)
+	if err != nil {
+		log.Printf("Error creating course: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating course"})
+		return
+	}
+	courseID, _ := result.LastInsertId()
+
+	for i, startsAt := range sessionTimes {
+		session := Workshop{
+			Title:       fmt.Sprintf("%s (Session %d/%d)", form.Title, i+1, len(sessionTimes)),
+			Description: form.Description,
+			Location:    form.Location,
+			MaxCapacity: form.MaxCapacity,
+			Currency:    form.Currency,
+			CourseID:    int(courseID),
+		}
+		if _, err := insertWorkshop(tx, session, startsAt); err != nil {
+			log.Printf("Error creating course session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating course"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing course: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating course"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/courses/%d", courseID))
+}
+
+// AdminCourseHandler shows everyone enrolled with their attendance per session
+func (h *Handlers) AdminCourseHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Course not found")
+		return
+	}
+
+	course, err := loadCourse(h.db, courseID)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Course not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading course %d: %v", courseID, err)
+		c.String(http.StatusInternalServerError, "Error loading course: %v", err)
+		return
+	}
+
+	rows, err := h.db.Query(`
+        SELECT e.id, e.first_name, e.last_name, e.email, COALESCE(e.phone, ''), e.created_at,
+               s.id, s.workshop_id, s.attended_at
+        FROM course_enrollments e
+        LEFT JOIN signups s ON s.course_enrollment_id = e.id
+        WHERE e.course_id = ? AND e.id IN `+enrolledCourseSignups+`
+        ORDER BY e.created_at ASC, e.id
+    `, courseID)
+	if err != nil {
+		log.Printf("Error querying enrollments: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading enrollments: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var enrollments []*CourseEnrollment
+	byID := map[int]*CourseEnrollment{}
+	for rows.Next() {
+		var e CourseEnrollment
+		var signupID, workshopID sql.NullInt64
+		var attendedAt sql.NullString
+		err := rows.Scan(&e.ID, &e.FirstName, &e.LastName, &e.Email, &e.Phone, &e.CreatedAt,
+			&signupID, &workshopID, &attendedAt)
+		if err != nil {
+			log.Printf("Error scanning enrollment row: %v", err)
+			continue
+		}
+
+		enrollment, ok := byID[e.ID]
+		if !ok {
+			e.CourseID = courseID
+			e.Attendance = map[int]SessionAttendance{}
+			enrollment = &e
+			byID[e.ID] = enrollment
+			enrollments = append(enrollments, enrollment)
+		}
+		if signupID.Valid {
+			enrollment.Attendance[int(workshopID.Int64)] = SessionAttendance{
+				SignupID:   int(signupID.Int64),
+				AttendedAt: attendedAt.String,
+			}
+		}
+	}
+
+	// Attendance count per session for the table footer
+	attended := map[int]int{}
+	for _, e := range enrollments {
+		for workshopID, a := range e.Attendance {
+			if a.AttendedAt != "" {
+				attended[workshopID]++
+			}
+		}
+	}
+
+	c.HTML(http.StatusOK, "admin_course.html", gin.H{
+		"Course":      course,
+		"Enrollments": enrollments,
+		"Attended":    attended,
+	})
+}
+
+// MarkAttendanceHandler records or clears attendance for one session signup
+func (h *Handlers) MarkAttendanceHandler(c *gin.Context) {
+	courseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Course not found")
+		return
+	}
+
+	var form struct {
+		SignupID int  `form:"signup_id" binding:"required"`
+		Attended bool `form:"attended"`
+	}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attendance"})
+		return
+	}
+
+	var attendedAt any
+	if form.Attended {
+		attendedAt = time.Now().UTC().Format(sqliteTimeLayout)
+	}
+
+	_, err = h.db.Exec(`
+        UPDATE signups SET attended_at = ?
+        WHERE id = ? AND workshop_id IN (SELECT id FROM workshops WHERE course_id = ?)
+    `, attendedAt, form.SignupID, courseID)
+	if err != nil {
+		log.Printf("Error saving attendance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving attendance"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/courses/%d", courseID))
+}
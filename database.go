@@ -2,17 +2,23 @@ package main
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// databasePath is the SQLite file, the directory it's in has to stay writable
+const databasePath = "./yoga.db"
+
 func initDB() *sql.DB {
-	db, err := sql.Open("sqlite3", "./yoga.db")
+	// Immediate transactions take the write lock up front, so two signups
+	// can't both see the last free seat
+	db, err := sql.Open(instrumentedDriver, databasePath+"?_txlock=immediate")
 	if err != nil {
-		log.Fatal(err)
+		fatal("Opening database failed", err)
 	}
 
 	// Create tables
@@ -23,7 +29,60 @@ func initDB() *sql.DB {
             description TEXT,
             date TEXT NOT NULL,
             location TEXT,
-            max_capacity INTEGER DEFAULT 20
+            max_capacity INTEGER DEFAULT 20,
+            max_seats_per_booking INTEGER NOT NULL DEFAULT 1,
+            verify_email BOOLEAN NOT NULL DEFAULT 0,
+            price_cents INTEGER NOT NULL DEFAULT 0,
+            currency TEXT NOT NULL DEFAULT 'CHF',
+            starts_at TEXT,
+            series_id INTEGER,
+            course_id INTEGER,
+            FOREIGN KEY (series_id) REFERENCES workshop_series(id),
+            FOREIGN KEY (course_id) REFERENCES courses(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS courses (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            title TEXT NOT NULL,
+            description TEXT,
+            location TEXT,
+            max_capacity INTEGER NOT NULL,
+            price_cents INTEGER NOT NULL DEFAULT 0,
+            currency TEXT NOT NULL DEFAULT 'CHF',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE TABLE IF NOT EXISTS course_enrollments (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            course_id INTEGER NOT NULL,
+            first_name TEXT NOT NULL,
+            last_name TEXT NOT NULL,
+            email TEXT NOT NULL,
+            phone TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (course_id) REFERENCES courses(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS workshop_series (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            title TEXT NOT NULL,
+            freq TEXT NOT NULL,
+            nth INTEGER,
+            starts_on TEXT NOT NULL,
+            start_time TEXT NOT NULL,
+            until TEXT,
+            count INTEGER,
+            skip_dates TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE TABLE IF NOT EXISTS participants (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            email TEXT UNIQUE NOT NULL,
+            first_name TEXT NOT NULL,
+            last_name TEXT NOT NULL,
+            phone TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
         );
 
         CREATE TABLE IF NOT EXISTS signups (
@@ -33,10 +92,193 @@ func initDB() *sql.DB {
             last_name TEXT NOT NULL,
             email TEXT NOT NULL,
             phone TEXT,
+            status TEXT NOT NULL DEFAULT 'confirmed',
+            hold_expires_at DATETIME,
+            stripe_session_id TEXT,
+            price_cents INTEGER NOT NULL DEFAULT 0,
+            discount_code TEXT,
+            payment_status TEXT NOT NULL DEFAULT 'pending',
+            amount_paid_cents INTEGER NOT NULL DEFAULT 0,
+            payment_method TEXT,
+            course_enrollment_id INTEGER,
+            attended_at DATETIME,
+            participant_id INTEGER,
+            seats INTEGER NOT NULL DEFAULT 1,
+            language TEXT,
+            refund_due BOOLEAN NOT NULL DEFAULT 0,
+            anonymized_at DATETIME,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (workshop_id) REFERENCES workshops(id),
+            FOREIGN KEY (course_enrollment_id) REFERENCES course_enrollments(id),
+            FOREIGN KEY (participant_id) REFERENCES participants(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS signup_guests (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            signup_id INTEGER NOT NULL,
+            position INTEGER NOT NULL,
+            name TEXT NOT NULL DEFAULT '',
+            FOREIGN KEY (signup_id) REFERENCES signups(id)
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_signup_guests_signup ON signup_guests (signup_id);
+
+        CREATE TABLE IF NOT EXISTS workshop_translations (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workshop_id INTEGER NOT NULL,
+            language TEXT NOT NULL,
+            title TEXT NOT NULL DEFAULT '',
+            description TEXT NOT NULL DEFAULT '',
+            UNIQUE (workshop_id, language),
+            FOREIGN KEY (workshop_id) REFERENCES workshops(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS workshop_questions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workshop_id INTEGER NOT NULL,
+            position INTEGER NOT NULL DEFAULT 0,
+            label TEXT NOT NULL,
+            kind TEXT NOT NULL,
+            options TEXT,
+            required BOOLEAN NOT NULL DEFAULT 0,
+            archived BOOLEAN NOT NULL DEFAULT 0,
+            FOREIGN KEY (workshop_id) REFERENCES workshops(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS signup_answers (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            signup_id INTEGER NOT NULL,
+            question_id INTEGER NOT NULL,
+            answer TEXT NOT NULL,
+            FOREIGN KEY (signup_id) REFERENCES signups(id),
+            FOREIGN KEY (question_id) REFERENCES workshop_questions(id)
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_signup_answers_signup ON signup_answers (signup_id);
+
+        CREATE TABLE IF NOT EXISTS consent_policies (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            label TEXT NOT NULL,
+            url TEXT,
+            version TEXT NOT NULL,
+            required BOOLEAN NOT NULL DEFAULT 1,
+            active BOOLEAN NOT NULL DEFAULT 1,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE TABLE IF NOT EXISTS signup_consents (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            signup_id INTEGER NOT NULL,
+            policy_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            version TEXT NOT NULL,
+            accepted BOOLEAN NOT NULL,
+            recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (signup_id) REFERENCES signups(id),
+            FOREIGN KEY (policy_id) REFERENCES consent_policies(id)
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_signup_consents_signup ON signup_consents (signup_id);
+
+        CREATE TABLE IF NOT EXISTS refunds (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            signup_id INTEGER NOT NULL,
+            amount_cents INTEGER NOT NULL,
+            note TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (signup_id) REFERENCES signups(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS price_tiers (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workshop_id INTEGER NOT NULL,
+            price_cents INTEGER NOT NULL,
+            ends_at DATETIME NOT NULL,
+            FOREIGN KEY (workshop_id) REFERENCES workshops(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS discount_codes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            code TEXT UNIQUE NOT NULL COLLATE NOCASE,
+            kind TEXT NOT NULL,
+            amount INTEGER NOT NULL,
+            max_uses INTEGER,
+            valid_from DATETIME,
+            valid_until DATETIME,
+            workshop_id INTEGER,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (workshop_id) REFERENCES workshops(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS email_outbox (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            to_email TEXT NOT NULL,
+            subject TEXT NOT NULL,
+            text_body TEXT NOT NULL,
+            html_body TEXT,
+            unsubscribe_url TEXT,
+            kind TEXT NOT NULL,
+            reference_id INTEGER,
+            signup_id INTEGER,
+            priority INTEGER NOT NULL DEFAULT 0,
+            status TEXT NOT NULL DEFAULT 'queued',
+            attempts INTEGER NOT NULL DEFAULT 0,
+            last_error TEXT,
+            next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            sent_at DATETIME,
+            FOREIGN KEY (signup_id) REFERENCES signups(id)
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_email_outbox_status ON email_outbox (status, next_attempt_at);
+
+        CREATE TABLE IF NOT EXISTS newsletter_subscriptions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            email TEXT UNIQUE NOT NULL,
+            first_name TEXT,
+            status TEXT NOT NULL DEFAULT 'pending',
+            requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            confirmed_at DATETIME,
+            unsubscribed_at DATETIME
+        );
+
+        CREATE TABLE IF NOT EXISTS broadcasts (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workshop_id INTEGER NOT NULL,
+            subject TEXT NOT NULL,
+            body TEXT NOT NULL,
+            include_pending BOOLEAN NOT NULL DEFAULT 0,
+            recipients INTEGER NOT NULL DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (workshop_id) REFERENCES workshops(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS newsletters (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            subject TEXT NOT NULL,
+            body TEXT NOT NULL,
+            workshop_id INTEGER,
+            recipients INTEGER NOT NULL DEFAULT 0,
             created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
             FOREIGN KEY (workshop_id) REFERENCES workshops(id)
         );
 
+        CREATE TABLE IF NOT EXISTS blocked_signups (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            form TEXT NOT NULL,
+            reason TEXT NOT NULL,
+            ip TEXT NOT NULL,
+            email TEXT,
+            user_agent TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE TABLE IF NOT EXISTS settings (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL
+        );
+
         CREATE TABLE IF NOT EXISTS admin_users (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             username TEXT UNIQUE NOT NULL,
@@ -45,9 +287,40 @@ func initDB() *sql.DB {
         );
     `)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Creating tables failed", err)
 	}
 
+	// Upgrade databases created before these columns existed
+	addColumnIfMissing(db, "workshops", "price_cents", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing(db, "workshops", "currency", "TEXT NOT NULL DEFAULT 'CHF'")
+	addColumnIfMissing(db, "workshops", "starts_at", "TEXT")
+	addColumnIfMissing(db, "workshops", "series_id", "INTEGER")
+	addColumnIfMissing(db, "workshops", "course_id", "INTEGER")
+	addColumnIfMissing(db, "workshops", "max_seats_per_booking", "INTEGER NOT NULL DEFAULT 1")
+	addColumnIfMissing(db, "workshops", "verify_email", "BOOLEAN NOT NULL DEFAULT 0")
+	backfillWorkshopStartTimes(db)
+	addColumnIfMissing(db, "courses", "price_cents", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing(db, "courses", "currency", "TEXT NOT NULL DEFAULT 'CHF'")
+	addColumnIfMissing(db, "signups", "status", "TEXT NOT NULL DEFAULT 'confirmed'")
+	addColumnIfMissing(db, "signups", "hold_expires_at", "DATETIME")
+	addColumnIfMissing(db, "signups", "stripe_session_id", "TEXT")
+	addColumnIfMissing(db, "signups", "price_cents", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing(db, "signups", "discount_code", "TEXT")
+	addColumnIfMissing(db, "signups", "payment_status", "TEXT NOT NULL DEFAULT 'pending'")
+	addColumnIfMissing(db, "signups", "amount_paid_cents", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing(db, "signups", "payment_method", "TEXT")
+	addColumnIfMissing(db, "signups", "course_enrollment_id", "INTEGER")
+	addColumnIfMissing(db, "signups", "attended_at", "DATETIME")
+	addColumnIfMissing(db, "signups", "participant_id", "INTEGER")
+	addColumnIfMissing(db, "signups", "anonymized_at", "DATETIME")
+	addColumnIfMissing(db, "signups", "seats", "INTEGER NOT NULL DEFAULT 1")
+	addColumnIfMissing(db, "signups", "language", "TEXT")
+	addColumnIfMissing(db, "signups", "refund_due", "BOOLEAN NOT NULL DEFAULT 0")
+	normalizeStoredPhones(db)
+	backfillParticipants(db)
+	addColumnIfMissing(db, "email_outbox", "priority", "INTEGER NOT NULL DEFAULT 0")
+	seedConsentPolicies(db)
+
 	// Check if default admin exists, if not create one
 	var count int
 	db.QueryRow("SELECT COUNT(*) FROM admin_users").Scan(&count)
@@ -61,22 +334,110 @@ func initDB() *sql.DB {
 		}
 		if defaultPassword == "" {
 			defaultPassword = "yoga2025"
-			log.Println("⚠️  WARNING: Using default password. Set DEFAULT_ADMIN_PASSWORD in production!")
+			slog.Warn("Using default admin password, set DEFAULT_ADMIN_PASSWORD in production")
 		}
 
 		// Create default admin
 		hash, err := bcrypt.GenerateFromPassword([]byte(defaultPassword), bcrypt.DefaultCost)
 		if err != nil {
-			log.Fatal(err)
+			fatal("Hashing default admin password failed", err)
 		}
 
 		_, err = db.Exec("INSERT INTO admin_users (username, password_hash) VALUES (?, ?)",
 			defaultUsername, string(hash))
 		if err != nil {
-			log.Fatal(err)
+			fatal("Creating default admin failed", err)
 		}
-		log.Printf("✓ Default admin user created (username: %s)\n", defaultUsername)
+		slog.Info("Default admin user created", "username", defaultUsername)
 	}
 
 	return db
 }
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		fatal("Reading table columns failed", err, "table", table)
+	}
+
+	exists := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			fatal("Reading table columns failed", err, "table", table)
+		}
+		if name == column {
+			exists = true
+		}
+	}
+	rows.Close()
+
+	if exists {
+		return
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		fatal("Adding column failed", err, "table", table, "column", column)
+	}
+	slog.Info("Added column", "table", table, "column", column)
+}
+
+// backfillWorkshopStartTimes fills starts_at for workshops created before it
+// existed by parsing the formatted date they were stored with.
+func backfillWorkshopStartTimes(db *sql.DB) {
+	rows, err := db.Query("SELECT id, date FROM workshops WHERE starts_at IS NULL")
+	if err != nil {
+		fatal("Loading workshops without start time failed", err)
+	}
+
+	startTimes := map[int]string{}
+	for rows.Next() {
+		var id int
+		var date string
+		if err := rows.Scan(&id, &date); err != nil {
+			fatal("Loading workshops without start time failed", err)
+		}
+
+		startsAt, err := time.ParseInLocation(workshopDateLayout, date, time.Local)
+		if err != nil {
+			slog.Warn("Could not parse workshop date", "workshop_id", id, "date", date)
+			continue
+		}
+		startTimes[id] = startsAt.Format(startsAtLayout)
+	}
+	rows.Close()
+
+	for id, startsAt := range startTimes {
+		if _, err := db.Exec("UPDATE workshops SET starts_at = ? WHERE id = ?", startsAt, id); err != nil {
+			fatal("Backfilling workshop start times failed", err)
+		}
+	}
+}
+
+// backfillParticipants links signups that have no participant yet, e.g. from
+// before participants existed. The most recent signup's details win.
+// Anonymized signups stay unlinked.
+func backfillParticipants(db *sql.DB) {
+	_, err := db.Exec(`
+        INSERT OR IGNORE INTO participants (email, first_name, last_name, phone)
+        SELECT LOWER(TRIM(email)), first_name, last_name, phone
+        FROM signups
+        WHERE participant_id IS NULL AND anonymized_at IS NULL
+        ORDER BY created_at DESC, id DESC
+    `)
+	if err != nil {
+		fatal("Backfilling participants failed", err)
+	}
+
+	_, err = db.Exec(`
+        UPDATE signups
+        SET participant_id = (SELECT id FROM participants WHERE email = LOWER(TRIM(signups.email)))
+        WHERE participant_id IS NULL AND anonymized_at IS NULL
+    `)
+	if err != nil {
+		fatal("Linking signups to participants failed", err)
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"html"
+	"io"
+	"log/slog"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/skip2/go-qrcode"
 	"gopkg.in/gomail.v2"
 )
 
-func sendSignupNotification(signup Signup, workshopTitle string, workshopDate string) error {
+func sendSignupNotification(ctx context.Context, signup Signup, workshopTitle string, workshopDate string) error {
 	// Get email config from environment
 	smtpHost := os.Getenv("SMTP_HOST")
 	smtpPort := os.Getenv("SMTP_PORT")
@@ -20,7 +25,7 @@ func sendSignupNotification(signup Signup, workshopTitle string, workshopDate st
 
 	// Skip if email not configured
 	if smtpHost == "" || smtpUsername == "" || smtpPassword == "" {
-		log.Println("⚠️  Email not configured, skipping notification")
+		slog.WarnContext(ctx, "Email not configured, skipping notification")
 		return nil
 	}
 
@@ -33,39 +38,31 @@ func sendSignupNotification(signup Signup, workshopTitle string, workshopDate st
 	m := gomail.NewMessage()
 	m.SetHeader("From", smtpFrom)
 	m.SetHeader("To", notificationEmail)
-	m.SetHeader("Subject", fmt.Sprintf("New Signup: %s", workshopTitle))
+	// The studio reads these in its own language
+	lang := defaultLanguage()
+	m.SetHeader("Subject", translate(lang, "email.notification.subject", workshopTitle))
 
-	body := fmt.Sprintf(`
-New workshop signup received!
-
-Workshop: %s
-Date: %s
-
-Participant Details:
-- Name: %s %s
-- Email: %s
-- Phone: %s
-
-Signed up at: %s
-
-View all signups at your admin panel.
-    `, workshopTitle, workshopDate, signup.FirstName, signup.LastName, signup.Email, signup.Phone, signup.CreatedAt)
+	body := translate(lang, "email.notification.body", workshopTitle, workshopDate,
+		signup.FirstName, signup.LastName, signup.Email, formatPhone(signup.Phone),
+		translate(signup.Language, "language.name"), groupDetails(signup, lang), signup.CreatedAt)
 
 	m.SetBody("text/plain", body)
 
 	// Send email
 	d := gomail.NewDialer(smtpHost, port, smtpUsername, smtpPassword)
 
-	if err := d.DialAndSend(m); err != nil {
-		log.Printf("Failed to send email: %v", err)
+	if err := dialAndSend(d, m); err != nil {
+		slog.ErrorContext(ctx, "Sending signup notification failed", "error", err, "signup_id", signup.ID)
 		return err
 	}
 
-	log.Println("✓ Signup notification email sent")
+	slog.InfoContext(ctx, "Signup notification sent", "signup_id", signup.ID)
 	return nil
 }
 
-func sendConfirmationEmail(signup Signup, workshopTitle string, workshopDate string, workshopLocation string) error {
+// sendConfirmationEmail also carries a QR code of checkinURL, which staff scan
+// at the door. An empty checkinURL sends the email without one.
+func sendConfirmationEmail(ctx context.Context, signup Signup, workshopTitle string, workshopDate string, workshopLocation string, checkinURL string) error {
 	// Get email config from environment
 	smtpHost := os.Getenv("SMTP_HOST")
 	smtpPort := os.Getenv("SMTP_PORT")
@@ -87,35 +84,86 @@ func sendConfirmationEmail(signup Signup, workshopTitle string, workshopDate str
 	m := gomail.NewMessage()
 	m.SetHeader("From", smtpFrom)
 	m.SetHeader("To", signup.Email)
-	m.SetHeader("Subject", fmt.Sprintf("Registration Confirmed: %s", workshopTitle))
-
-	body := fmt.Sprintf(`
-Dear %s,
-
-Thank you for registering for our workshop!
-
-Workshop Details:
-- Title: %s
-- Date: %s
-- Location: %s
-
-We look forward to seeing you there!
-
-If you have any questions, please reply to this email.
+	lang := signup.Language
+	m.SetHeader("Subject", translate(lang, "email.confirmation.subject", workshopTitle))
 
-Namaste 🙏
-    `, signup.FirstName, workshopTitle, workshopDate, workshopLocation)
+	body := translate(lang, "email.confirmation.body", signup.FirstName, workshopTitle, workshopDate,
+		workshopLocation, groupDetails(signup, lang))
 
 	m.SetBody("text/plain", body)
 
+	if checkinURL != "" {
+		png, err := qrcode.Encode(checkinURL, qrcode.Medium, 256)
+		if err != nil {
+			slog.ErrorContext(ctx, "Creating check-in QR code failed", "error", err, "signup_id", signup.ID)
+		} else {
+			m.AddAlternative("text/html", fmt.Sprintf(`<pre style="font-family: inherit">%s</pre>
+<p>%s</p>
+<p><img src="cid:checkin.png" alt="%s" width="256" height="256"></p>
+`, html.EscapeString(body), html.EscapeString(translate(lang, "email.checkin_code")),
+				html.EscapeString(translate(lang, "email.checkin_code_alt"))))
+			m.Embed("checkin.png", gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(png)
+				return err
+			}))
+		}
+	}
+
 	// Send email
 	d := gomail.NewDialer(smtpHost, port, smtpUsername, smtpPassword)
 
-	if err := d.DialAndSend(m); err != nil {
-		log.Printf("Failed to send confirmation email: %v", err)
+	if err := dialAndSend(d, m); err != nil {
+		slog.ErrorContext(ctx, "Sending confirmation email failed", "error", err, "signup_id", signup.ID)
 		return err
 	}
 
-	log.Println("✓ Confirmation email sent to participant")
+	slog.InfoContext(ctx, "Confirmation email sent", "signup_id", signup.ID)
 	return nil
 }
+
+// emailConfigured tells whether SMTP settings are present at all
+func emailConfigured() bool {
+	return os.Getenv("SMTP_HOST") != "" && os.Getenv("SMTP_USERNAME") != "" && os.Getenv("SMTP_PASSWORD") != ""
+}
+
+// sendEmail sends a single message. htmlBody is optional. A non-empty
+// unsubscribeURL adds the List-Unsubscribe headers mail clients show as a
+// button, which bulk mail needs to get past the big providers' filters.
+func sendEmail(to, subject, textBody, htmlBody, unsubscribeURL string) error {
+	// Get email config from environment
+	smtpHost := os.Getenv("SMTP_HOST")
+	smtpPort := os.Getenv("SMTP_PORT")
+	smtpUsername := os.Getenv("SMTP_USERNAME")
+	smtpPassword := os.Getenv("SMTP_PASSWORD")
+	smtpFrom := os.Getenv("SMTP_FROM")
+
+	port, err := strconv.Atoi(smtpPort)
+	if err != nil {
+		port = 587
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", smtpFrom)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", subject)
+	if unsubscribeURL != "" {
+		m.SetHeader("List-Unsubscribe", "<"+unsubscribeURL+">")
+		m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+
+	m.SetBody("text/plain", textBody)
+	if htmlBody != "" {
+		m.AddAlternative("text/html", htmlBody)
+	}
+
+	d := gomail.NewDialer(smtpHost, port, smtpUsername, smtpPassword)
+	return dialAndSend(d, m)
+}
+
+// dialAndSend sends m and records how long the SMTP server took
+func dialAndSend(d *gomail.Dialer, m *gomail.Message) error {
+	start := time.Now()
+	err := d.DialAndSend(m)
+	observeEmail(start, err)
+	return err
+}
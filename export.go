@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/unicode/norm"
+)
+
+// exportRow is one signup together with the workshop it belongs to
+type exportRow struct {
+	Signup   Signup
+	Workshop Workshop
+}
+
+// attendance is empty until the workshop has started, then attended or no-show
+func (r exportRow) attendance() string {
+	switch {
+	case r.Signup.AttendedAt != "":
+		return "attended"
+	case r.Signup.Status == SignupConfirmed && r.Workshop.StartsAt <= time.Now().Format(startsAtLayout):
+		return "no-show"
+	}
+	return ""
+}
+
+// exportColumn is a column that can be picked for the export. Money columns
+// set Cents so XLSX gets a real number and CSV the formatted amount.
+type exportColumn struct {
+	Key     string
+	Title   string
+	Default bool
+	Value   func(r exportRow) string
+	Cents   func(r exportRow) int
+}
+
+var exportColumns = []exportColumn{
+	{Key: "signup_id", Title: "Signup ID", Value: func(r exportRow) string { return strconv.Itoa(r.Signup.ID) }},
+	{Key: "workshop", Title: "Workshop", Value: func(r exportRow) string { return r.Workshop.Title }},
+	{Key: "workshop_date", Title: "Workshop Date", Value: func(r exportRow) string { return r.Workshop.StartsAt }},
+	{Key: "location", Title: "Location", Value: func(r exportRow) string { return r.Workshop.Location }},
+	{Key: "first_name", Title: "First Name", Default: true, Value: func(r exportRow) string { return r.Signup.FirstName }},
+	{Key: "last_name", Title: "Last Name", Default: true, Value: func(r exportRow) string { return r.Signup.LastName }},
+	{Key: "email", Title: "Email", Default: true, Value: func(r exportRow) string { return r.Signup.Email }},
+	{Key: "phone", Title: "Phone", Default: true, Value: func(r exportRow) string { return r.Signup.Phone }},
+	{Key: "status", Title: "Status", Default: true, Value: func(r exportRow) string { return r.Signup.Status }},
+	{Key: "seats", Title: "Seats", Default: true, Value: func(r exportRow) string { return strconv.Itoa(r.Signup.Seats) }},
+	{Key: "guests", Title: "Guests", Default: true, Value: func(r exportRow) string {
+		return strings.Join(r.Signup.Attendees()[1:], "; ")
+	}},
+	{Key: "price", Title: "Price", Default: true, Cents: func(r exportRow) int { return r.Signup.PriceCents }},
+	{Key: "discount_code", Title: "Discount Code", Default: true, Value: func(r exportRow) string { return r.Signup.DiscountCode }},
+	{Key: "payment_status", Title: "Payment Status", Default: true, Value: func(r exportRow) string { return r.Signup.PaymentStatus }},
+	{Key: "amount_paid", Title: "Amount Paid", Default: true, Cents: func(r exportRow) int { return r.Signup.AmountPaidCents }},
+	{Key: "payment_method", Title: "Payment Method", Default: true, Value: func(r exportRow) string { return r.Signup.PaymentMethod }},
+	{Key: "refunded", Title: "Refunded", Default: true, Cents: func(r exportRow) int { return r.Signup.RefundedCents }},
+	{Key: "attendance", Title: "Attendance", Default: true, Value: exportRow.attendance},
+	{Key: "answers", Title: "Answers", Default: true, Value: func(r exportRow) string {
+		answers := make([]string, len(r.Signup.Answers))
+		for i, a := range r.Signup.Answers {
+			answers[i] = a.String()
+		}
+		return strings.Join(answers, "; ")
+	}},
+	{Key: "consents", Title: "Consents", Default: true, Value: func(r exportRow) string {
+		answers := make([]string, len(r.Signup.Consents))
+		for i, sc := range r.Signup.Consents {
+			answers[i] = sc.String()
+		}
+		return strings.Join(answers, "; ")
+	}},
+	{Key: "checked_in_at", Title: "Checked In At", Default: true, Value: func(r exportRow) string {
+		if t, err := parseDBTime(r.Signup.AttendedAt); err == nil {
+			return t.Local().Format(startsAtLayout)
+		}
+		return r.Signup.AttendedAt
+	}},
+	{Key: "signed_up_at", Title: "Signed Up At", Default: true, Value: func(r exportRow) string {
+		if t, err := parseDBTime(r.Signup.CreatedAt); err == nil {
+			return t.Local().Format(startsAtLayout)
+		}
+		return r.Signup.CreatedAt
+	}},
+}
+
+var exportDelimiters = map[string]rune{"comma": ',', "semicolon": ';', "tab": '\t'}
+
+// exportOptions is what the export form sends. Without any options the export
+// is the selected workshop with the default columns, as before.
+type exportOptions struct {
+	Scope      string   `form:"scope" binding:"omitempty,oneof=workshop range all"`
+	WorkshopID int      `form:"workshop"`
+	From       string   `form:"from"`
+	To         string   `form:"to"`
+	Columns    []string `form:"columns"`
+	Delimiter  string   `form:"delimiter" binding:"omitempty,oneof=comma semicolon tab"`
+	BOM        bool     `form:"bom"`
+	Format     string   `form:"format" binding:"omitempty,oneof=csv xlsx"`
+}
+
+func (o exportOptions) columns() []exportColumn {
+	var columns []exportColumn
+	for _, col := range exportColumns {
+		if len(o.Columns) == 0 && col.Default {
+			columns = append(columns, col)
+			continue
+		}
+		for _, key := range o.Columns {
+			if key == col.Key {
+				columns = append(columns, col)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// ExportFormHandler shows the export options
+func (h *Handlers) ExportFormHandler(c *gin.Context) {
+	workshops, err := h.listWorkshops()
+	if err != nil {
+		log.Printf("Error listing workshops: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "export.html", gin.H{
+		"Workshops":  workshops,
+		"WorkshopID": h.selectedWorkshopID(c),
+		"Columns":    exportColumns,
+	})
+}
+
+func (h *Handlers) ExportCSVHandler(c *gin.Context) {
+	var opts exportOptions
+	if err := c.ShouldBindQuery(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if opts.Scope == "" {
+		opts.Scope = "workshop"
+	}
+
+	columns := opts.columns()
+	if len(columns) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pick at least one column"})
+		return
+	}
+
+	where := "1 = 1"
+	var args []any
+	var name string
+	switch opts.Scope {
+	case "workshop":
+		if opts.WorkshopID == 0 {
+			opts.WorkshopID = h.selectedWorkshopID(c)
+		}
+		var title string
+		err := h.db.QueryRow("SELECT title FROM workshops WHERE id = ?", opts.WorkshopID).Scan(&title)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No workshop found"})
+			return
+		}
+		where = "w.id = ?"
+		args = append(args, opts.WorkshopID)
+		name = fmt.Sprintf("%s-signups", slugify(title))
+	case "range":
+		from, errFrom := time.Parse("2006-01-02", opts.From)
+		to, errTo := time.Parse("2006-01-02", opts.To)
+		if errFrom != nil || errTo != nil || to.Before(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range"})
+			return
+		}
+		// starts_at is local "YYYY-MM-DD HH:MM", so plain string bounds work
+		where = "w.starts_at >= ? AND w.starts_at < ?"
+		args = append(args, opts.From, to.AddDate(0, 0, 1).Format("2006-01-02"))
+		name = fmt.Sprintf("signups-%s-to-%s", opts.From, opts.To)
+	case "all":
+		name = "signups-all"
+	}
+	name += "-" + time.Now().Format("2006-01-02")
+
+	rows, err := h.db.Query(`
+        SELECT s.id, s.first_name, s.last_name, s.email, s.phone, s.status, s.seats, s.price_cents,
+               COALESCE(s.discount_code, ''), s.payment_status, s.amount_paid_cents,
+               COALESCE(s.payment_method, ''),
+               (SELECT COALESCE(SUM(amount_cents), 0) FROM refunds WHERE signup_id = s.id),
+               COALESCE(s.attended_at, ''), s.created_at,
+               w.id, w.title, COALESCE(w.starts_at, ''), COALESCE(w.location, ''), w.currency
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE `+where+`
+        ORDER BY w.starts_at ASC, s.created_at ASC
+    `, args...)
+	if err != nil {
+		log.Printf("Error querying signups for export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading signups"})
+		return
+	}
+	defer rows.Close()
+
+	var data []exportRow
+	for rows.Next() {
+		var r exportRow
+		err := rows.Scan(&r.Signup.ID, &r.Signup.FirstName, &r.Signup.LastName, &r.Signup.Email,
+			&r.Signup.Phone, &r.Signup.Status, &r.Signup.Seats, &r.Signup.PriceCents, &r.Signup.DiscountCode,
+			&r.Signup.PaymentStatus, &r.Signup.AmountPaidCents, &r.Signup.PaymentMethod,
+			&r.Signup.RefundedCents, &r.Signup.AttendedAt, &r.Signup.CreatedAt,
+			&r.Workshop.ID, &r.Workshop.Title, &r.Workshop.StartsAt, &r.Workshop.Location,
+			&r.Workshop.Currency)
+		if err != nil {
+			log.Printf("Error scanning export row: %v", err)
+			continue
+		}
+		data = append(data, r)
+	}
+
+	answers, err := h.loadAnswers(where, args...)
+	if err != nil {
+		log.Printf("Error loading answers for export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading signups"})
+		return
+	}
+	consents, err := h.loadConsents(where, args...)
+	if err != nil {
+		log.Printf("Error loading consents for export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading signups"})
+		return
+	}
+	guests, err := h.loadGuests(where, args...)
+	if err != nil {
+		log.Printf("Error loading guests for export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading signups"})
+		return
+	}
+	for i := range data {
+		data[i].Signup.Answers = answers[data[i].Signup.ID]
+		data[i].Signup.Consents = consents[data[i].Signup.ID]
+		data[i].Signup.Guests = guests[data[i].Signup.ID]
+	}
+
+	if opts.Format == "xlsx" {
+		// Totals go below the list, separated by an empty line. The CSV stays
+		// one row per signup so it can be imported elsewhere.
+		var attendance Attendance
+		for _, r := range data {
+			switch r.attendance() {
+			case "attended":
+				attendance.Attended += r.Signup.Seats
+			case "no-show":
+				attendance.NoShows += r.Signup.Seats
+			}
+		}
+		totals := [][]string{
+			{},
+			{"Attended", strconv.Itoa(attendance.Attended)},
+			{"No-shows", strconv.Itoa(attendance.NoShows)},
+		}
+
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xlsx", name))
+		if err := writeXLSX(c.Writer, columns, data, totals); err != nil {
+			log.Printf("Error writing XLSX export: %v", err)
+		}
+		return
+	}
+
+	// Set headers for CSV download
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", name))
+
+	// Excel only reads UTF-8 correctly with a byte order mark
+	if opts.BOM {
+		c.Writer.WriteString("\uFEFF")
+	}
+
+	writer := csv.NewWriter(c.Writer)
+	if delimiter, ok := exportDelimiters[opts.Delimiter]; ok {
+		writer.Comma = delimiter
+	}
+	defer writer.Flush()
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.Title
+	}
+	writer.Write(header)
+
+	for _, r := range data {
+		record := make([]string, len(columns))
+		for i, col := range columns {
+			if col.Cents != nil {
+				record[i] = formatMoney(col.Cents(r), r.Workshop.Currency)
+			} else {
+				record[i] = col.Value(r)
+			}
+		}
+		writer.Write(record)
+	}
+}
+
+// slugify turns a workshop title into something safe for a file name,
+// e.g. "Yin & Yoga Nidra – Zürich" becomes "yin-yoga-nidra-zurich"
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accents split off by NFD
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "workshop"
+	}
+	if b.Len() > 60 {
+		return strings.TrimRight(b.String()[:60], "-")
+	}
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// FormErrors holds one message per form field, keyed by the field's form
+// name like "first_name", so pages can show each next to its input.
+// Problems not tied to one field are kept under "".
+type FormErrors map[string]string
+
+// Add keeps the first message of each field
+func (e FormErrors) Add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// Get is for field names built in templates, like answer_3
+func (e FormErrors) Get(field string) string {
+	return e[field]
+}
+
+// Message is the summary shown above the form: a problem not tied to a
+// field if there is one, otherwise a hint to look at the fields
+func (e FormErrors) Message(lang string) string {
+	if message, ok := e[""]; ok {
+		return message
+	}
+	return translate(lang, "error.form_check")
+}
+
+// FormValues are the values a form was submitted with, for filling it in
+// again after an error
+type FormValues url.Values
+
+// formValues returns what was posted. Binding has parsed the form already.
+func formValues(c *gin.Context) FormValues {
+	return FormValues(c.Request.PostForm)
+}
+
+func (v FormValues) Get(field string) string {
+	return url.Values(v).Get(field)
+}
+
+// Has reports whether value was submitted for field, for checkboxes and
+// select options
+func (v FormValues) Has(field string, value any) bool {
+	return slices.Contains(v[field], fmt.Sprint(value))
+}
+
+// At returns the i-th value of a repeated field like guest_names
+func (v FormValues) At(field string, i int) string {
+	if i < 0 || i >= len(v[field]) {
+		return ""
+	}
+	return v[field][i]
+}
+
+// bindErrors turns the error of binding form into messages per field.
+// Values that can't even be parsed, like letters for a number, fail before
+// validation and end up under "".
+func bindErrors(form any, err error, lang string) FormErrors {
+	errs := FormErrors{}
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		errs.Add("", translate(lang, "error.form_invalid"))
+		return errs
+	}
+
+	formType := reflect.TypeOf(form)
+	for formType.Kind() == reflect.Pointer {
+		formType = formType.Elem()
+	}
+	for _, fe := range fieldErrors {
+		field := fe.Field()
+		if sf, ok := formType.FieldByName(fe.StructField()); ok {
+			if name, _, _ := strings.Cut(sf.Tag.Get("form"), ","); name != "" {
+				field = name
+			}
+		}
+		errs.Add(field, fieldMessage(fe, lang))
+	}
+	return errs
+}
+
+func fieldMessage(fe validator.FieldError, lang string) string {
+	text := fe.Kind() == reflect.String
+	switch {
+	case fe.Tag() == "required":
+		return translate(lang, "error.field.required")
+	case fe.Tag() == "email":
+		return translate(lang, "error.field.email")
+	case fe.Tag() == "min" && text:
+		return translate(lang, "error.field.min_length", fe.Param())
+	case fe.Tag() == "min":
+		return translate(lang, "error.field.min", fe.Param())
+	case fe.Tag() == "max" && text:
+		return translate(lang, "error.field.max_length", fe.Param())
+	case fe.Tag() == "max":
+		return translate(lang, "error.field.max", fe.Param())
+	default:
+		return translate(lang, "error.field.invalid")
+	}
+}
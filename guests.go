@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSeatsPerBookingLimit caps what admins can allow per booking. Larger
+// groups book with the studio directly.
+const maxSeatsPerBookingLimit = 10
+
+// Attendees lists everyone a booking covers, starting with the person who
+// booked. Guests without a name show as "Guest 2", "Guest 3" and so on.
+func (s Signup) Attendees() []string {
+	return s.attendees("Guest %d")
+}
+
+// attendees is Attendees with unnamed guests shown as guestFormat, which
+// gets the guest's number
+func (s Signup) attendees(guestFormat string) []string {
+	attendees := []string{strings.TrimSpace(s.FirstName + " " + s.LastName)}
+	for i := 1; i < s.Seats; i++ {
+		name := ""
+		if i-1 < len(s.Guests) {
+			name = s.Guests[i-1]
+		}
+		if name == "" {
+			name = fmt.Sprintf(guestFormat, i+1)
+		}
+		attendees = append(attendees, name)
+	}
+	return attendees
+}
+
+// GuestCount is how many people come along with the person who booked
+func (s Signup) GuestCount() int {
+	return max(s.Seats-1, 0)
+}
+
+// guestNamesFromForm returns one name per extra seat, empty where none was given
+func guestNamesFromForm(c *gin.Context, seats int) []string {
+	given := c.PostFormArray("guest_names")
+	names := make([]string, seats-1)
+	for i := range names {
+		if i < len(given) {
+			names[i] = strings.TrimSpace(given[i])
+		}
+	}
+	return names
+}
+
+func recordGuests(db execer, signupID int64, names []string) error {
+	for i, name := range names {
+		_, err := db.Exec(`
+            INSERT INTO signup_guests (signup_id, position, name) VALUES (?, ?, ?)
+        `, signupID, i, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadGuests returns guest names by signup ID. The condition may use s for
+// signups and w for workshops.
+func (h *Handlers) loadGuests(condition string, args ...any) (map[int][]string, error) {
+	rows, err := h.db.Query(`
+        SELECT g.signup_id, g.name
+        FROM signup_guests g
+        JOIN signups s ON s.id = g.signup_id
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE `+condition+`
+        ORDER BY g.signup_id, g.position
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guests := make(map[int][]string)
+	for rows.Next() {
+		var signupID int
+		var name string
+		if err := rows.Scan(&signupID, &name); err != nil {
+			return nil, err
+		}
+		guests[signupID] = append(guests[signupID], name)
+	}
+	return guests, rows.Err()
+}
+
+// seatOptions are the choices for the seat picker on the signup form, never
+// more than the seats still free. Without a choice to make there is none.
+func seatOptions(w Workshop) []int {
+	limit := min(w.MaxSeatsPerBooking, w.MaxCapacity-w.SignupCount)
+	if limit < 2 {
+		return nil
+	}
+	options := []int{1}
+	for seats := 2; seats <= limit; seats++ {
+		options = append(options, seats)
+	}
+	return options
+}
+
+// groupDetails is the seat count and attendee list for emails about a group
+// booking, one booking covers everyone so only one email goes out
+func groupDetails(s Signup, lang string) string {
+	if s.Seats <= 1 {
+		return ""
+	}
+	attendees := strings.Join(s.attendees(translate(lang, "email.guest")), ", ")
+	return "- " + translate(lang, "email.seats", s.Seats) + "\n- " + translate(lang, "email.attendees", attendees) + "\n"
+}
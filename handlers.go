@@ -2,11 +2,14 @@ package main
 
 import (
 	"database/sql"
-	"encoding/csv"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"math"
 	"net/http"
-	"regexp"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,107 +18,379 @@ import (
 )
 
 type Handlers struct {
-	db *sql.DB
+	db           *sql.DB
+	stripe       *StripeClient
+	holdDuration time.Duration
+	verifyWithin time.Duration
+	signingKey   []byte
+	spam         *spamGuard
 }
 
-func validatePhone(phone string) bool {
-	if phone == "" {
-		return true // Phone is optional
+func NewHandlers(db *sql.DB) *Handlers {
+	return &Handlers{
+		db:           db,
+		stripe:       newStripeClientFromEnv(),
+		holdDuration: holdDurationFromEnv(),
+		verifyWithin: verifyDurationFromEnv(),
+		signingKey:   loadSigningKey(db),
+		spam:         newSpamGuardFromEnv(),
+	}
+}
+
+// baseURL is used to build links that leave the site, e.g. Stripe redirects
+func baseURL(c *gin.Context) string {
+	if base := os.Getenv("BASE_URL"); base != "" {
+		return strings.TrimRight(base, "/")
 	}
 
-	// Remove common formatting characters
-	cleaned := strings.ReplaceAll(phone, " ", "")
-	cleaned = strings.ReplaceAll(cleaned, "-", "")
-	cleaned = strings.ReplaceAll(cleaned, "(", "")
-	cleaned = strings.ReplaceAll(cleaned, ")", "")
-	cleaned = strings.ReplaceAll(cleaned, "+", "")
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
 
-	// Check if we have at least 10 digits
-	digitRegex := regexp.MustCompile(`\d`)
-	digits := digitRegex.FindAllString(cleaned, -1)
+// parsePriceCents turns a price like "45" or "45.50" into cents, empty means free
+func parsePriceCents(price string) (int, error) {
+	price = strings.TrimSpace(price)
+	if price == "" {
+		return 0, nil
+	}
 
-	return len(digits) >= 10
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid price %q", price)
+	}
+	return int(math.Round(value * 100)), nil
 }
 
-func NewHandlers(db *sql.DB) *Handlers {
-	return &Handlers{db: db}
+// currentWorkshopID picks the next upcoming workshop, or the most recent one
+// when nothing is scheduled. It returns 0 if there are no workshops at all.
+func currentWorkshopID(q queryRower) int {
+	now := time.Now().Format(startsAtLayout)
+
+	var id int
+	err := q.QueryRow(`
+        SELECT id FROM workshops
+        WHERE starts_at >= ?
+        ORDER BY starts_at ASC
+        LIMIT 1
+    `, now).Scan(&id)
+	if err == nil {
+		return id
+	}
+
+	q.QueryRow(`
+        SELECT id FROM workshops
+        ORDER BY starts_at DESC
+        LIMIT 1
+    `).Scan(&id)
+	return id
+}
+
+// selectedWorkshopID returns the workshop chosen in the admin panel via
+// ?workshop=, falling back to the current one
+func (h *Handlers) selectedWorkshopID(c *gin.Context) int {
+	if id, err := strconv.Atoi(c.Query("workshop")); err == nil {
+		return id
+	}
+	return currentWorkshopID(h.db)
+}
+
+// listWorkshops returns all workshops for the admin workshop picker, newest first
+func (h *Handlers) listWorkshops() ([]Workshop, error) {
+	rows, err := h.db.Query(`
+        SELECT id, title, date, COALESCE(series_id, 0)
+        FROM workshops
+        ORDER BY starts_at DESC
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workshops []Workshop
+	for rows.Next() {
+		var w Workshop
+		if err := rows.Scan(&w.ID, &w.Title, &w.Date, &w.SeriesID); err != nil {
+			return nil, err
+		}
+		workshops = append(workshops, w)
+	}
+	return workshops, rows.Err()
 }
 
 func (h *Handlers) HomeHandler(c *gin.Context) {
+	lang := requestLanguage(c)
+
 	var workshop Workshop
 	err := h.db.QueryRow(`
-        SELECT id, title, description, date, location, max_capacity 
+        SELECT id, title, description, date, location, max_capacity, max_seats_per_booking,
+               price_cents, currency, COALESCE(starts_at, ''), COALESCE(course_id, 0) 
         FROM workshops 
-        ORDER BY date DESC 
-        LIMIT 1
-    `).Scan(&workshop.ID, &workshop.Title, &workshop.Description,
-		&workshop.Date, &workshop.Location, &workshop.MaxCapacity)
+        WHERE id = ?
+    `, currentWorkshopID(h.db)).Scan(&workshop.ID, &workshop.Title, &workshop.Description,
+		&workshop.Date, &workshop.Location, &workshop.MaxCapacity, &workshop.MaxSeatsPerBooking,
+		&workshop.PriceCents, &workshop.Currency, &workshop.StartsAt, &workshop.CourseID)
 
 	if err != nil {
-		c.HTML(http.StatusOK, "no_workshop.html", nil)
+		c.HTML(http.StatusOK, "no_workshop.html", gin.H{
+			"Lang":      lang,
+			"Languages": languageOptions(lang),
+		})
 		return
 	}
+	workshop.Date = workshopDate(workshop, lang)
+	h.localizeWorkshop(&workshop, lang)
+
+	policies, err := h.consentPolicies(true)
+	if err != nil {
+		slog.ErrorContext(c, "Loading consent policies failed", "error", err)
+	}
 
-	// Count signups
-	h.db.QueryRow("SELECT COUNT(*) FROM signups WHERE workshop_id = ?",
-		workshop.ID).Scan(&workshop.SignupCount)
+	questions, err := h.workshopQuestions(workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Loading questions failed", "error", err)
+	}
+
+	page := h.workshopPage(c, lang, workshop, policies, questions)
+	page["Success"] = c.Query("success") == "true"
+	page["PaymentSuccess"] = c.Query("payment") == "success"
+	page["PaymentCancelled"] = c.Query("payment") == "cancelled"
+	page["PaymentFailed"] = c.Query("payment") == "failed"
+	page["Verification"] = c.Query("verify")
+	c.HTML(http.StatusOK, "home.html", page)
+}
 
-	// Check for success message
-	success := c.Query("success") == "true"
+// workshopPage is what home.html needs to show a workshop and its signup form
+func (h *Handlers) workshopPage(c *gin.Context, lang string, workshop Workshop, policies []ConsentPolicy, questions []WorkshopQuestion) gin.H {
+	// Count taken seats, including seats held during payment
+	workshop.SignupCount, _ = seatsTaken(h.db, workshop.ID)
+
+	// Show the early-bird price while one applies
+	priceCents, earlyBird, err := currentPrice(h.db, workshop, time.Now())
+	if err != nil {
+		slog.ErrorContext(c, "Loading price failed", "error", err)
+		priceCents = workshop.PriceCents
+	}
+
+	return gin.H{
+		"Lang":            lang,
+		"Languages":       languageOptions(lang),
+		"Workshop":        workshop,
+		"ConsentPolicies": policies,
+		"Questions":       questions,
+		"SeatOptions":     seatOptions(workshop),
+		"CurrentPrice":    formatMoney(priceCents, workshop.Currency),
+		"EarlyBird":       earlyBird,
+		"PayOnline":       workshop.IsPaid() && h.stripe != nil,
+		"Spam":            h.spamFields(),
+	}
+}
 
-	c.HTML(http.StatusOK, "home.html", gin.H{
-		"Workshop": workshop,
-		"Success":  success,
-	})
+// signupFormError shows the signup form again with what was entered and
+// what's wrong with it
+func (h *Handlers) signupFormError(c *gin.Context, status int, lang string, workshop Workshop,
+	policies []ConsentPolicy, questions []WorkshopQuestion, errs FormErrors) {
+	page := h.workshopPage(c, lang, workshop, policies, questions)
+	page["Form"] = formValues(c)
+	page["Errors"] = errs
+	page["Error"] = errs.Message(lang)
+	c.HTML(status, "home.html", page)
 }
 
 func (h *Handlers) SignupHandler(c *gin.Context) {
-	var form SignupForm
-	if err := c.ShouldBind(&form); err != nil {
-		c.HTML(http.StatusBadRequest, "home.html", gin.H{
-			"Error": "Please fill in all required fields correctly.",
-		})
-		return
+	// The form carries the language it was shown in, emails go out in it
+	lang := normalizeLanguage(c.PostForm("lang"))
+	if lang == "" {
+		lang = requestLanguage(c)
 	}
 
-	// Get country code from form
-	countryCode := c.PostForm("country_code")
+	// Counted once the handler returns, every way out but errors sets it
+	outcome := signupError
+	defer countSignup("workshop", &outcome)
 
-	// Combine country code with phone number if phone is provided
-	fullPhone := form.Phone
-	if form.Phone != "" && countryCode != "" {
-		fullPhone = countryCode + " " + form.Phone
+	// Everything wrong with the form is collected so it can be shown at once
+	var form SignupForm
+	errs := FormErrors{}
+	if err := c.ShouldBind(&form); err != nil {
+		errs = bindErrors(&form, err, lang)
 	}
 
-	// Validate phone number
-	if !validatePhone(fullPhone) {
-		c.HTML(http.StatusBadRequest, "home.html", gin.H{
-			"Error": "Please enter a valid phone number with at least 7 digits.",
-		})
-		return
+	// Phone numbers are stored in E.164, e.g. +41791234567
+	fullPhone, err := normalizePhone(c.PostForm("country_code"), form.Phone)
+	if err != nil {
+		errs.Add("phone", translate(lang, "error.phone_invalid"))
 	}
 
 	// Get workshop details for email
 	var workshop Workshop
-	err := h.db.QueryRow(`
-        SELECT id, title, date, location 
+	err = h.db.QueryRow(`
+        SELECT id, title, date, location, max_capacity, max_seats_per_booking, price_cents, currency,
+               COALESCE(starts_at, ''), COALESCE(course_id, 0), verify_email
         FROM workshops 
         WHERE id = ?
-    `, form.WorkshopID).Scan(&workshop.ID, &workshop.Title, &workshop.Date, &workshop.Location)
+    `, form.WorkshopID).Scan(&workshop.ID, &workshop.Title, &workshop.Date, &workshop.Location,
+		&workshop.MaxCapacity, &workshop.MaxSeatsPerBooking, &workshop.PriceCents, &workshop.Currency,
+		&workshop.StartsAt, &workshop.CourseID, &workshop.VerifyEmail)
+
+	// Not a signup attempt for any workshop, so it isn't counted
+	if err == sql.ErrNoRows {
+		outcome = ""
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workshop not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c, "Loading workshop failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	workshop.Date = workshopDate(workshop, lang)
+	h.localizeWorkshop(&workshop, lang)
+
+	// Course sessions are only booked together through the course page
+	if workshop.CourseID != 0 {
+		outcome = ""
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/courses/%d", workshop.CourseID))
+		return
+	}
+
+	policies, err := h.consentPolicies(true)
+	if err != nil {
+		slog.ErrorContext(c, "Loading consent policies failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	questions, err := h.workshopQuestions(workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Loading questions failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+
+	seats := max(form.Seats, 1)
+	guests := guestNamesFromForm(c, seats)
+	if seats > workshop.MaxSeatsPerBooking {
+		errs.Add("seats", translate(lang, "error.too_many_seats", workshop.MaxSeatsPerBooking))
+	}
+	if reason := h.checkSpam(c, "signup", form.Email); reason != "" {
+		outcome = signupSpam
+		if reason == spamHoneypot {
+			// Bots get the usual thank you, nothing to learn from
+			c.Redirect(http.StatusSeeOther, "/?success=true")
+			return
+		}
+		h.signupFormError(c, reason.Status(), lang, workshop, policies, questions,
+			FormErrors{"": translate(lang, reason.MessageKey())})
+		return
+	}
+
+	answers := answersFromForm(c, questions, lang, errs)
+	consents := consentsFromForm(c, policies, lang, errs)
+	if len(errs) > 0 {
+		outcome = signupValidationError
+		h.signupFormError(c, http.StatusBadRequest, lang, workshop, policies, questions, errs)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		slog.ErrorContext(c, "Starting signup transaction failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	defer tx.Rollback()
+
+	taken, err := seatsTaken(tx, workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Counting seats failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	// The whole group gets in or nobody does
+	if taken+seats > workshop.MaxCapacity {
+		outcome = signupFull
+		message := translate(lang, "error.full")
+		if left := workshop.MaxCapacity - taken; left == 1 {
+			message = translate(lang, "error.one_seat_left")
+		} else if left > 1 {
+			message = translate(lang, "error.seats_left", left)
+		}
+		h.signupFormError(c, http.StatusConflict, lang, workshop, policies, questions, FormErrors{"": message})
+		return
+	}
+
+	// Early-bird tiers and discount codes decide what this signup pays
+	now := time.Now()
+	seatPriceCents, _, err := currentPrice(tx, workshop, now)
+	if err != nil {
+		slog.ErrorContext(c, "Loading price failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	priceCents := seatPriceCents * seats
+
+	var discountCode any
+	if form.DiscountCode != "" && workshop.IsPaid() {
+		discount, err := lookupDiscountCode(tx, form.DiscountCode, workshop.ID, now)
+		if errors.Is(err, errInvalidDiscountCode) {
+			outcome = signupValidationError
+			errs.Add("discount_code", translate(lang, "error.discount_invalid"))
+			h.signupFormError(c, http.StatusBadRequest, lang, workshop, policies, questions, errs)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c, "Checking discount code failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+			return
+		}
+		priceCents = discount.Apply(priceCents)
+		discountCode = discount.Code
+	}
+
+	// Paid signups only get a seat held until Stripe confirms the payment.
+	// Without Stripe configured, fees are collected offline as before.
+	// Workshops that verify email addresses hold the seat until the link in
+	// the email is opened first, payment follows after that. Without SMTP
+	// nobody could ever verify, so the check is skipped.
+	payOnline := priceCents > 0 && h.stripe != nil
+	verify := workshop.VerifyEmail && emailConfigured()
+	status := SignupConfirmed
+	var holdExpiresAt time.Time
+	var holdUntil any
+	if verify {
+		status = SignupPendingVerification
+		holdExpiresAt = now.UTC().Add(h.verifyWithin)
+		holdUntil = holdExpiresAt.Format(sqliteTimeLayout)
+	} else if payOnline {
+		status = SignupPendingPayment
+		holdExpiresAt = now.UTC().Add(h.holdDuration)
+		holdUntil = holdExpiresAt.Format(sqliteTimeLayout)
+	}
 
+	// Nothing to collect for free seats
+	paymentStatus := PaymentPending
+	if priceCents == 0 {
+		paymentStatus = PaymentPaid
+	}
+
+	participantID, err := upsertParticipant(tx, form.FirstName, form.LastName, form.Email, fullPhone)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Workshop not found"})
+		slog.ErrorContext(c, "Saving participant failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
 		return
 	}
 
 	// Insert signup with full phone number including country code
-	result, err := h.db.Exec(`
-        INSERT INTO signups (workshop_id, first_name, last_name, email, phone) 
-        VALUES (?, ?, ?, ?, ?)
-    `, form.WorkshopID, form.FirstName, form.LastName, form.Email, fullPhone)
+	result, err := tx.Exec(`
+        INSERT INTO signups (workshop_id, first_name, last_name, email, phone, status, hold_expires_at,
+                             seats, price_cents, discount_code, payment_status, participant_id, language) 
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, form.WorkshopID, form.FirstName, form.LastName, form.Email, fullPhone, status, holdUntil,
+		seats, priceCents, discountCode, paymentStatus, participantID, lang)
 
 	if err != nil {
-		log.Printf("Error inserting signup: %v", err)
+		slog.ErrorContext(c, "Inserting signup failed", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
 		return
 	}
@@ -123,66 +398,155 @@ func (h *Handlers) SignupHandler(c *gin.Context) {
 	// Get the inserted signup ID
 	signupID, _ := result.LastInsertId()
 
+	if err := recordGuests(tx, signupID, guests); err != nil {
+		slog.ErrorContext(c, "Saving guests failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	if err := recordAnswers(tx, signupID, answers); err != nil {
+		slog.ErrorContext(c, "Saving answers failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	if err := recordConsents(tx, signupID, consents); err != nil {
+		slog.ErrorContext(c, "Saving consents failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(c, "Committing signup failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving signup"})
+		return
+	}
+	outcome = signupSuccess
+	slog.InfoContext(c, "Signup saved", "signup_id", signupID, "workshop_id", form.WorkshopID,
+		"status", status, "seats", seats)
+
 	// Create signup object for emails
 	signup := Signup{
-		ID:         int(signupID),
-		WorkshopID: form.WorkshopID,
-		FirstName:  form.FirstName,
-		LastName:   form.LastName,
-		Email:      form.Email,
-		Phone:      fullPhone,
-		CreatedAt:  time.Now().Format("2006-01-02 15:04:05"),
+		ID:            int(signupID),
+		WorkshopID:    form.WorkshopID,
+		FirstName:     form.FirstName,
+		LastName:      form.LastName,
+		Email:         form.Email,
+		Phone:         fullPhone,
+		Status:        status,
+		Seats:         seats,
+		Guests:        guests,
+		Language:      lang,
+		PriceCents:    priceCents,
+		PaymentStatus: paymentStatus,
+		CreatedAt:     time.Now().Format("2006-01-02 15:04:05"),
 	}
 
-	// Send notification email to admin (non-blocking)
-	go sendSignupNotification(signup, workshop.Title, workshop.Date)
+	// Opting in is independent of the seat, so it also counts for unpaid holds
+	if form.Newsletter {
+		h.requestNewsletterOptIn(c, form.FirstName, form.Email)
+	}
 
-	// Send confirmation email to participant (non-blocking)
-	go sendConfirmationEmail(signup, workshop.Title, workshop.Date, workshop.Location)
+	if verify {
+		h.sendVerificationEmail(c, signup, workshop, holdExpiresAt)
+		c.Redirect(http.StatusSeeOther, "/?verify=sent")
+		return
+	}
+
+	if payOnline {
+		// The seat is given back, they can send the form again as it was
+		if err := h.startCheckout(c, signup, workshop, holdExpiresAt); err != nil {
+			h.signupFormError(c, http.StatusBadGateway, lang, workshop, policies, questions,
+				FormErrors{"": translate(lang, "error.payment_failed")})
+		}
+		return
+	}
+
+	h.sendSignupEmails(c, signup, workshop)
 
 	c.Redirect(http.StatusSeeOther, "/?success=true")
 }
 
+// sendSignupEmails notifies the admin and the participant once a seat is confirmed
+func (h *Handlers) sendSignupEmails(c *gin.Context, signup Signup, workshop Workshop) {
+	// Each side gets the workshop in its own language
+	notified, confirmed := workshop, workshop
+	h.localizeWorkshop(&notified, defaultLanguage())
+	h.localizeWorkshop(&confirmed, signup.Language)
+
+	// The emails are sent after the request is done, so they log with its
+	// context rather than with c, which gin reuses
+	ctx := c.Request.Context()
+
+	// Send notification email to admin (non-blocking)
+	go sendSignupNotification(ctx, signup, notified.Title, workshopDate(workshop, defaultLanguage()))
+
+	// Send confirmation email to participant (non-blocking)
+	go sendConfirmationEmail(ctx, signup, confirmed.Title, workshopDate(workshop, signup.Language),
+		workshop.Location, h.checkinURL(c, signup))
+}
+
 func (h *Handlers) AdminHandler(c *gin.Context) {
+	h.renderAdmin(c, http.StatusOK, nil)
+}
+
+// renderAdmin shows the admin page. Entries of extra are added to or
+// replace the page's data, e.g. to show a form again after an error.
+func (h *Handlers) renderAdmin(c *gin.Context, status int, extra gin.H) {
 	// Get username from context
 	username, _ := c.Get("username")
 
 	// Check for success/error messages
 	passwordChanged := c.Query("password_changed") == "true"
 	passwordError := c.Query("password_error")
+	pricingError := c.Query("pricing_error")
+	imported := c.Query("imported")
+
+	workshops, err := h.listWorkshops()
+	if err != nil {
+		slog.ErrorContext(c, "Listing workshops failed", "error", err)
+	}
 
 	// Get workshop
 	var workshop Workshop
-	err := h.db.QueryRow(`
-        SELECT id, title, date, max_capacity 
+	err = h.db.QueryRow(`
+        SELECT id, title, date, max_capacity, price_cents, currency, COALESCE(series_id, 0),
+               COALESCE(starts_at, '')
         FROM workshops 
-        ORDER BY date DESC 
-        LIMIT 1
-    `).Scan(&workshop.ID, &workshop.Title, &workshop.Date, &workshop.MaxCapacity)
+        WHERE id = ?
+    `, h.selectedWorkshopID(c)).Scan(&workshop.ID, &workshop.Title, &workshop.Date, &workshop.MaxCapacity,
+		&workshop.PriceCents, &workshop.Currency, &workshop.SeriesID, &workshop.StartsAt)
 
 	if err != nil {
 		// No workshop exists, just show the create form
-		c.HTML(http.StatusOK, "admin.html", gin.H{
+		page := gin.H{
 			"Workshop":        nil,
+			"Workshops":       workshops,
 			"Signups":         []Signup{},
 			"Count":           0,
+			"Translations":    translationFields(nil),
 			"Username":        username,
 			"PasswordChanged": passwordChanged,
 			"PasswordError":   passwordError,
-		})
+			"PricingError":    pricingError,
+		}
+		maps.Copy(page, extra)
+		c.HTML(status, "admin.html", page)
 		return
 	}
 
 	// Get signups - with error logging
 	rows, err := h.db.Query(`
-        SELECT id, first_name, last_name, email, phone, created_at 
+        SELECT id, first_name, last_name, email, phone, status, seats, price_cents,
+               COALESCE(discount_code, ''), payment_status, amount_paid_cents,
+               COALESCE(payment_method, ''),
+               (SELECT COALESCE(SUM(amount_cents), 0) FROM refunds WHERE signup_id = signups.id),
+               refund_due, COALESCE(attended_at, ''), created_at 
         FROM signups 
         WHERE workshop_id = ? 
         ORDER BY created_at DESC
     `, workshop.ID)
 	if err != nil {
 		// Log the actual error
-		log.Printf("Error querying signups: %v", err)
+		slog.ErrorContext(c, "Querying signups failed", "error", err)
 		c.String(http.StatusInternalServerError, "Error loading signups: %v", err)
 		return
 	}
@@ -191,29 +555,85 @@ func (h *Handlers) AdminHandler(c *gin.Context) {
 	var signups []Signup
 	for rows.Next() {
 		var s Signup
-		err := rows.Scan(&s.ID, &s.FirstName, &s.LastName, &s.Email, &s.Phone, &s.CreatedAt)
+		err := rows.Scan(&s.ID, &s.FirstName, &s.LastName, &s.Email, &s.Phone, &s.Status,
+			&s.Seats, &s.PriceCents, &s.DiscountCode, &s.PaymentStatus, &s.AmountPaidCents,
+			&s.PaymentMethod, &s.RefundedCents, &s.RefundDue, &s.AttendedAt, &s.CreatedAt)
 		if err != nil {
-			log.Printf("Error scanning signup row: %v", err)
+			slog.ErrorContext(c, "Scanning signup row failed", "error", err)
 			continue
 		}
+		if s.AttendedAt != "" {
+			s.AttendedAt = formatCheckinTime(s.AttendedAt)
+		}
 		signups = append(signups, s)
 	}
 
 	// Check for any errors during iteration
 	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating signups: %v", err)
+		slog.ErrorContext(c, "Iterating signups failed", "error", err)
 		c.String(http.StatusInternalServerError, "Error loading signups: %v", err)
 		return
 	}
 
-	c.HTML(http.StatusOK, "admin.html", gin.H{
+	answers, err := h.loadAnswers("w.id = ?", workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Loading answers failed", "error", err)
+	}
+	consents, err := h.loadConsents("w.id = ?", workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Loading consents failed", "error", err)
+	}
+	guests, err := h.loadGuests("w.id = ?", workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Loading guests failed", "error", err)
+	}
+	for i := range signups {
+		signups[i].Answers = answers[signups[i].ID]
+		signups[i].Consents = consents[signups[i].ID]
+		signups[i].Guests = guests[signups[i].ID]
+	}
+
+	// Expired holds stay listed but don't count towards capacity
+	count, err := seatsTaken(h.db, workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Counting seats failed", "error", err)
+	}
+
+	tiers, codes, err := h.loadPricing(workshop)
+	if err != nil {
+		slog.ErrorContext(c, "Loading pricing failed", "error", err)
+	}
+
+	totals, err := paymentTotals(h.db, workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Loading payment totals failed", "error", err)
+	}
+
+	attendance, err := attendanceCounts(h.db, workshop.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Counting attendance failed", "error", err)
+	}
+
+	page := gin.H{
 		"Workshop":        workshop,
+		"Workshops":       workshops,
 		"Signups":         signups,
-		"Count":           len(signups),
+		"Count":           count,
+		"Attendance":      attendance,
+		"Started":         workshop.StartsAt <= time.Now().Format(startsAtLayout),
+		"PaymentTotals":   totals,
+		"PriceTiers":      tiers,
+		"DiscountCodes":   codes,
+		"Lang":            fallbackLanguage,
 		"Username":        username,
 		"PasswordChanged": passwordChanged,
 		"PasswordError":   passwordError,
-	})
+		"PricingError":    pricingError,
+		"Imported":        imported,
+		"Translations":    translationFields(nil),
+	}
+	maps.Copy(page, extra)
+	c.HTML(status, "admin.html", page)
 }
 
 func (h *Handlers) CreateWorkshopHandler(c *gin.Context) {
@@ -224,31 +644,109 @@ func (h *Handlers) CreateWorkshopHandler(c *gin.Context) {
 		WorkshopTime string `form:"workshop_time" binding:"required"`
 		Location     string `form:"location" binding:"required"`
 		MaxCapacity  int    `form:"max_capacity" binding:"required,min=1"`
+		MaxSeats     int    `form:"max_seats_per_booking" binding:"omitempty,min=1,max=10"`
+		VerifyEmail  bool   `form:"verify_email"`
+		Price        string `form:"price"`
+		Currency     string `form:"currency" binding:"omitempty,oneof=CHF EUR"`
+		Repeat       string `form:"repeat" binding:"omitempty,oneof=weekly biweekly monthly"`
+		Nth          int    `form:"nth" binding:"omitempty,oneof=-1 1 2 3 4"`
+		RepeatUntil  string `form:"repeat_until"`
+		RepeatCount  int    `form:"repeat_count" binding:"omitempty,min=1"`
+		SkipDates    string `form:"skip_dates"`
 	}
 
+	// Admin pages are in English
+	errs := FormErrors{}
 	if err := c.ShouldBind(&form); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		errs = bindErrors(&form, err, fallbackLanguage)
 	}
 
+	questions, err := questionsFromForm(c)
+	if err != nil {
+		errs.Add("questions", err.Error())
+	}
+	translations := translationsFromForm(c)
+
 	// Parse the date and time
-	dateTime, err := time.Parse("2006-01-02 15:04", form.WorkshopDate+" "+form.WorkshopTime)
+	var dateTime time.Time
+	if form.WorkshopDate != "" && form.WorkshopTime != "" {
+		dateTime, err = time.ParseInLocation(startsAtLayout, form.WorkshopDate+" "+form.WorkshopTime, time.Local)
+		if err != nil {
+			errs.Add("workshop_date", "Invalid date or time format")
+		}
+	}
+
+	priceCents, err := parsePriceCents(form.Price)
 	if err != nil {
-		log.Printf("Error parsing date/time: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date or time format"})
+		errs.Add("price", "Invalid price")
+	}
+	if form.Currency == "" {
+		form.Currency = "CHF"
+	}
+
+	var recurrence Recurrence
+	if form.Repeat != "" && len(errs) == 0 {
+		recurrence, err = parseRecurrence(form.Repeat, form.Nth, dateTime, form.RepeatUntil,
+			form.RepeatCount, form.SkipDates)
+		if err != nil {
+			errs.Add("repeat", err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		h.renderAdmin(c, http.StatusBadRequest, gin.H{
+			"Form":         formValues(c),
+			"Errors":       errs,
+			"NewQuestions": questions,
+			"Translations": translationFields(translations),
+		})
 		return
 	}
 
-	// Format as: "Saturday, March 15, 2025 at 6:00 PM"
-	formattedDate := dateTime.Format("Monday, January 2, 2006 at 3:04 PM")
+	workshop := Workshop{
+		Title:              form.Title,
+		Description:        form.Description,
+		Location:           form.Location,
+		MaxCapacity:        form.MaxCapacity,
+		MaxSeatsPerBooking: form.MaxSeats,
+		VerifyEmail:        form.VerifyEmail,
+		PriceCents:         priceCents,
+		Currency:           form.Currency,
+	}
 
-	_, err = h.db.Exec(`
-        INSERT INTO workshops (title, description, date, location, max_capacity) 
-        VALUES (?, ?, ?, ?, ?)
-    `, form.Title, form.Description, formattedDate, form.Location, form.MaxCapacity)
+	if form.Repeat != "" {
+		seriesID, err := h.createSeries(workshop, recurrence, questions, translations)
+		if err != nil {
+			slog.ErrorContext(c, "Creating workshop series failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating workshop series"})
+			return
+		}
+
+		slog.InfoContext(c, "Created workshop series", "series_id", seriesID)
+		c.Redirect(http.StatusSeeOther, "/admin")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		slog.ErrorContext(c, "Starting workshop transaction failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating workshop"})
+		return
+	}
+	defer tx.Rollback()
 
+	workshopID, err := insertWorkshop(tx, workshop, dateTime)
+	if err == nil {
+		err = saveWorkshopQuestions(tx, workshopID, questions)
+	}
+	if err == nil {
+		err = saveWorkshopTranslations(tx, workshopID, translations)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
-		log.Printf("Error creating workshop: %v", err)
+		slog.ErrorContext(c, "Creating workshop failed", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating workshop"})
 		return
 	}
@@ -256,6 +754,32 @@ func (h *Handlers) CreateWorkshopHandler(c *gin.Context) {
 	c.Redirect(http.StatusSeeOther, "/admin")
 }
 
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertWorkshop(db execer, w Workshop, startsAt time.Time) (int64, error) {
+	result, err := db.Exec(`
+        INSERT INTO workshops (title, description, date, location, max_capacity, max_seats_per_booking,
+                               verify_email, price_cents, currency, starts_at, series_id, course_id) 
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, w.Title, w.Description, startsAt.Format(workshopDateLayout), w.Location, w.MaxCapacity,
+		max(w.MaxSeatsPerBooking, 1), w.VerifyEmail, w.PriceCents, w.Currency, startsAt.Format(startsAtLayout), nullableID(w.SeriesID),
+		nullableID(w.CourseID))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// nullableID stores 0 as NULL for optional references
+func nullableID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
 func (h *Handlers) ChangePasswordHandler(c *gin.Context) {
 	username, _ := c.Get("username")
 
@@ -306,56 +830,3 @@ func (h *Handlers) ChangePasswordHandler(c *gin.Context) {
 
 	c.Redirect(http.StatusSeeOther, "/admin?password_changed=true")
 }
-
-func (h *Handlers) ExportCSVHandler(c *gin.Context) {
-	// Get workshop
-	var workshop Workshop
-	err := h.db.QueryRow(`
-        SELECT id, title, date 
-        FROM workshops 
-        ORDER BY date DESC 
-        LIMIT 1
-    `).Scan(&workshop.ID, &workshop.Title, &workshop.Date)
-
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No workshop found"})
-		return
-	}
-
-	// Get signups
-	rows, err := h.db.Query(`
-        SELECT first_name, last_name, email, phone, created_at 
-        FROM signups 
-        WHERE workshop_id = ? 
-        ORDER BY created_at ASC
-    `, workshop.ID)
-	if err != nil {
-		log.Printf("Error querying signups for CSV: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading signups"})
-		return
-	}
-	defer rows.Close()
-
-	// Set headers for CSV download
-	filename := fmt.Sprintf("workshop-signups-%s.csv", time.Now().Format("2006-01-02"))
-	c.Header("Content-Type", "text/csv")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-	// Create CSV writer
-	writer := csv.NewWriter(c.Writer)
-	defer writer.Flush()
-
-	// Write header
-	writer.Write([]string{"First Name", "Last Name", "Email", "Phone", "Signed Up At"})
-
-	// Write data
-	for rows.Next() {
-		var firstName, lastName, email, phone, createdAt string
-		err := rows.Scan(&firstName, &lastName, &email, &phone, &createdAt)
-		if err != nil {
-			log.Printf("Error scanning CSV row: %v", err)
-			continue
-		}
-		writer.Write([]string{firstName, lastName, email, phone, createdAt})
-	}
-}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fly restarts the machine when /healthz fails and stops routing to it while
+// /readyz does, see the checks in fly.toml.
+
+// readyTimeout bounds each check, a locked or hanging database shouldn't
+// keep the health check waiting
+const readyTimeout = 2 * time.Second
+
+// outboxGrace is how late queued email may be on top of the time the worker
+// needs for the backlog at SMTP_RATE_PER_MINUTE
+const outboxGrace = 15 * time.Minute
+
+// HealthCheck is the result of one readiness check
+type HealthCheck struct {
+	Status string `json:"status"` // ok, warn or failing
+	Error  string `json:"error,omitempty"`
+	Detail gin.H  `json:"detail,omitempty"`
+}
+
+// HealthzHandler only tells that the process is up and serving requests
+func (h *Handlers) HealthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadyzHandler checks what the app needs to work: a readable database and
+// a writable data directory. It answers 503 when one of them fails. Email is
+// reported too, but only as a warning: signups keep working while the outbox
+// waits, and taking the site offline wouldn't get any email sent.
+func (h *Handlers) ReadyzHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]HealthCheck{
+		"database": h.checkDatabase(ctx),
+		"storage":  checkStorage(filepath.Dir(databasePath)),
+		"email":    h.checkEmail(ctx),
+	}
+
+	status, code := "ok", http.StatusOK
+	for name, check := range checks {
+		switch check.Status {
+		case "failing":
+			status, code = "degraded", http.StatusServiceUnavailable
+			slog.WarnContext(c, "Readiness check failing", "check", name, "error", check.Error)
+		case "warn":
+			if status == "ok" {
+				status = "warn"
+			}
+			slog.WarnContext(c, "Readiness check warning", "check", name, "detail", check.Detail)
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+// checkDatabase reads from the database file, a ping alone may be answered
+// by an open connection without touching it
+func (h *Handlers) checkDatabase(ctx context.Context) HealthCheck {
+	var tables int
+	err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&tables)
+	if err != nil {
+		return failing(err)
+	}
+	return HealthCheck{Status: "ok"}
+}
+
+// checkStorage writes a file next to the database, which fails when the
+// volume is full or mounted read-only
+func checkStorage(dir string) HealthCheck {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return failing(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(make([]byte, 4096))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return failing(err)
+	}
+	return HealthCheck{Status: "ok"}
+}
+
+// checkEmail reports whether SMTP is configured and how far the outbox is
+// behind. It warns when queued email is overdue by more than the backlog
+// explains, because SMTP isn't configured or sends keep failing.
+func (h *Handlers) checkEmail(ctx context.Context) HealthCheck {
+	var queued, failed int
+	var oldestDue sql.NullString
+	err := h.db.QueryRowContext(ctx, `
+        SELECT COUNT(CASE WHEN status = 'queued' THEN 1 END),
+               COUNT(CASE WHEN status = 'failed' THEN 1 END),
+               MIN(CASE WHEN status = 'queued' THEN next_attempt_at END)
+        FROM email_outbox
+    `).Scan(&queued, &failed, &oldestDue)
+	if err != nil {
+		return HealthCheck{Status: "warn", Detail: gin.H{"warning": err.Error()}}
+	}
+
+	check := HealthCheck{Status: "ok", Detail: gin.H{
+		"smtp_configured": emailConfigured(),
+		"outbox_queued":   queued,
+		"outbox_failed":   failed,
+	}}
+	if !oldestDue.Valid {
+		return check
+	}
+
+	due, err := parseDBTime(oldestDue.String)
+	if err != nil {
+		check.Status = "warn"
+		check.Detail["warning"] = err.Error()
+		return check
+	}
+	overdue := max(time.Since(due), 0)
+	check.Detail["outbox_overdue_seconds"] = int(overdue.Seconds())
+
+	allowed := time.Duration(queued)*time.Minute/time.Duration(outboxRateFromEnv()) + outboxGrace
+	if overdue > allowed {
+		warning := fmt.Sprintf("queued email is %s overdue", overdue.Round(time.Minute))
+		if !emailConfigured() {
+			warning += ", SMTP is not configured"
+		}
+		check.Status = "warn"
+		check.Detail["warning"] = warning
+	}
+	return check
+}
+
+func failing(err error) HealthCheck {
+	return HealthCheck{Status: "failing", Error: err.Error()}
+}
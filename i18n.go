@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Languages of the public pages and participant emails, in the order the
+// language switcher shows them
+var supportedLanguages = []string{"de", "fr", "it", "en"}
+
+// fallbackLanguage is used when nothing better is known. Its catalog has to
+// contain every key.
+const fallbackLanguage = "en"
+
+const languageCookie = "lang"
+
+// catalogs holds the translated messages by language, loaded from
+// locales/<lang>.json at startup
+var catalogs = map[string]map[string]string{}
+
+func loadCatalogs(dir string) {
+	for _, lang := range supportedLanguages {
+		data, err := os.ReadFile(filepath.Join(dir, lang+".json"))
+		if err != nil {
+			log.Fatalf("Error loading %s messages: %v", lang, err)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			log.Fatalf("Error parsing %s messages: %v", lang, err)
+		}
+		catalogs[lang] = messages
+	}
+
+	for key := range catalogs[fallbackLanguage] {
+		for _, lang := range supportedLanguages {
+			if _, ok := catalogs[lang][key]; !ok {
+				log.Printf("⚠️  Missing %s translation for %q", lang, key)
+			}
+		}
+	}
+	log.Printf("✓ Loaded messages for %s", strings.Join(supportedLanguages, ", "))
+}
+
+// translate looks up a message, falling back to English and then to the key
+// itself. Arguments are filled in like fmt.Sprintf.
+func translate(lang, key string, args ...any) string {
+	message, ok := catalogs[lang][key]
+	if !ok {
+		message, ok = catalogs[fallbackLanguage][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// normalizeLanguage turns "de-CH" or "DE" into "de", or "" if we don't
+// speak it
+func normalizeLanguage(tag string) string {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	if slices.Contains(supportedLanguages, base) {
+		return base
+	}
+	return ""
+}
+
+// defaultLanguage is the studio's own language, set with DEFAULT_LANGUAGE.
+// Admin notifications use it, and visitors whose browser asks for none of
+// ours get it.
+func defaultLanguage() string {
+	if lang := normalizeLanguage(os.Getenv("DEFAULT_LANGUAGE")); lang != "" {
+		return lang
+	}
+	return fallbackLanguage
+}
+
+// requestLanguage picks the visitor's language: a ?lang= from the language
+// switcher (remembered in a cookie), then the cookie, then the browser's
+// Accept-Language header
+func requestLanguage(c *gin.Context) string {
+	if lang := normalizeLanguage(c.Query("lang")); lang != "" {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(languageCookie, lang, 365*24*60*60, "/", "", false, true)
+		return lang
+	}
+	if cookie, err := c.Cookie(languageCookie); err == nil {
+		if lang := normalizeLanguage(cookie); lang != "" {
+			return lang
+		}
+	}
+	if lang := acceptedLanguage(c.GetHeader("Accept-Language")); lang != "" {
+		return lang
+	}
+	return defaultLanguage()
+}
+
+// acceptedLanguage returns the supported language the Accept-Language header
+// ranks highest, e.g. "fr" for "fr-CH, fr;q=0.9, en;q=0.8"
+func acceptedLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang := normalizeLanguage(tag); lang != "" && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// formatLocalDate formats a time with one of the language's date layouts,
+// e.g. date.layout, which are Go layouts in English. The weekday and month
+// names are then swapped for the translated ones.
+func formatLocalDate(t time.Time, lang, layoutKey string) string {
+	text := t.Format(translate(lang, layoutKey))
+	weekdays := strings.Split(translate(lang, "date.weekdays"), ",")
+	months := strings.Split(translate(lang, "date.months"), ",")
+	if len(weekdays) == 7 {
+		text = strings.Replace(text, t.Weekday().String(), weekdays[t.Weekday()], 1)
+	}
+	if len(months) == 12 {
+		text = strings.Replace(text, t.Month().String(), months[t.Month()-1], 1)
+	}
+	return text
+}
+
+// workshopDate is the workshop's start in the given language. Workshops
+// without a start time keep the date text they were created with.
+func workshopDate(w Workshop, lang string) string {
+	startsAt, err := time.ParseInLocation(startsAtLayout, w.StartsAt, time.Local)
+	if err != nil {
+		return w.Date
+	}
+	return formatLocalDate(startsAt, lang, "date.layout")
+}
+
+// LanguageOption is an entry of the language switcher
+type LanguageOption struct {
+	Code    string
+	Name    string
+	Current bool
+	Path    string // the page to show in this language
+}
+
+func languageOptions(current string) []LanguageOption {
+	return languageOptionsFor("/", current)
+}
+
+// languageOptionsFor links the switcher to another page than the home page
+func languageOptionsFor(path, current string) []LanguageOption {
+	options := make([]LanguageOption, len(supportedLanguages))
+	for i, lang := range supportedLanguages {
+		options[i] = LanguageOption{Code: lang, Name: translate(lang, "language.name"), Current: lang == current, Path: path}
+	}
+	return options
+}
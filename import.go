@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Imports are small spreadsheets, anything bigger is most likely a mistake
+const maxImportBytes = 2 << 20
+
+// ImportRow is one CSV line in the import preview
+type ImportRow struct {
+	Line   int
+	Raw    string
+	Errors []string
+}
+
+// importHeaders maps the column names we accept to our field names. Matching
+// ignores case, spaces and underscores, so "First Name" equals first_name.
+var importHeaders = map[string]string{
+	"firstname":    "first_name",
+	"vorname":      "first_name",
+	"lastname":     "last_name",
+	"nachname":     "last_name",
+	"email":        "email",
+	"emailaddress": "email",
+	"phone":        "phone",
+	"telefon":      "phone",
+	"countrycode":  "country_code",
+	"title":        "title",
+	"description":  "description",
+	"date":         "date",
+	"time":         "time",
+	"location":     "location",
+	"maxcapacity":  "max_capacity",
+	"capacity":     "max_capacity",
+	"price":        "price",
+	"currency":     "currency",
+}
+
+type importFile struct {
+	Header  []string
+	Records []map[string]string
+	Raw     []string // the original cells of each record for the preview
+}
+
+// readImportCSV takes the uploaded file, or on commit the CSV text the
+// preview carried along, and parses it. Comma and semicolon files both work.
+func readImportCSV(c *gin.Context) (string, importFile, error) {
+	var data []byte
+	if fh, err := c.FormFile("file"); err == nil {
+		if fh.Size > maxImportBytes {
+			return "", importFile{}, errors.New("file is too large")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return "", importFile{}, err
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return "", importFile{}, err
+		}
+	} else {
+		data = []byte(c.PostForm("csv"))
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "", importFile{}, errors.New("please choose a CSV file")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", importFile{}, fmt.Errorf("could not read CSV: %v", err)
+	}
+
+	var file importFile
+	file.Header = records[0]
+	for _, record := range records[1:] {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		values := map[string]string{}
+		for i, name := range file.Header {
+			key := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+			if field, ok := importHeaders[key]; ok && i < len(record) {
+				values[field] = strings.TrimSpace(record[i])
+			}
+		}
+		file.Records = append(file.Records, values)
+		file.Raw = append(file.Raw, strings.Join(record, " · "))
+	}
+	if len(file.Records) == 0 {
+		return "", importFile{}, errors.New("the file has no rows below the header")
+	}
+
+	return string(data), file, nil
+}
+
+// rowErrors lists the problems of one row as "column: message", worded
+// like the errors on the forms. Fields are named by their form tag, which
+// matches the CSV column.
+func rowErrors(form any, err error) []string {
+	errs := bindErrors(form, err, fallbackLanguage)
+	fields := slices.Sorted(maps.Keys(errs))
+
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field == "" {
+			messages = append(messages, errs[field])
+			continue
+		}
+		messages = append(messages, field+": "+errs[field])
+	}
+	return messages
+}
+
+// ImportHandler shows the upload forms for both imports
+func (h *Handlers) ImportHandler(c *gin.Context) {
+	workshops, err := h.listWorkshops()
+	if err != nil {
+		log.Printf("Error listing workshops: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "import.html", gin.H{
+		"Workshops":  workshops,
+		"WorkshopID": h.selectedWorkshopID(c),
+		"Imported":   c.Query("imported"),
+		"Error":      c.Query("import_error"),
+	})
+}
+
+// importError sends the admin back to the upload page with a message
+func importError(c *gin.Context, message string) {
+	message = strings.ToUpper(message[:1]) + message[1:]
+	c.Redirect(http.StatusSeeOther, "/admin/import?import_error="+url.QueryEscape(message))
+}
+
+// ImportSignupsHandler validates signups from a CSV against one workshop.
+// Without commit it only shows the preview, with commit it adds all valid
+// rows in one transaction, or nothing if a row fails and skip_invalid is off.
+func (h *Handlers) ImportSignupsHandler(c *gin.Context) {
+	workshopID, _ := strconv.Atoi(c.PostForm("workshop_id"))
+
+	var workshop Workshop
+	err := h.db.QueryRow(`
+        SELECT id, title, date, max_capacity, price_cents, currency, COALESCE(course_id, 0)
+        FROM workshops WHERE id = ?
+    `, workshopID).Scan(&workshop.ID, &workshop.Title, &workshop.Date, &workshop.MaxCapacity,
+		&workshop.PriceCents, &workshop.Currency, &workshop.CourseID)
+	if err != nil {
+		importError(c, "Please choose a workshop")
+		return
+	}
+	if workshop.CourseID != 0 {
+		importError(c, "Course sessions can't be imported one by one")
+		return
+	}
+
+	raw, file, err := readImportCSV(c)
+	if err != nil {
+		importError(c, err.Error())
+		return
+	}
+
+	commit := c.PostForm("commit") == "true"
+	skipInvalid := c.PostForm("skip_invalid") == "true"
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting import transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing signups"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Checked inside the transaction, so seats can't run out between
+	// validating and inserting
+	taken, err := seatsTaken(tx, workshop.ID)
+	if err != nil {
+		log.Printf("Error counting seats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing signups"})
+		return
+	}
+
+	existing := map[string]bool{}
+	emailRows, err := tx.Query(`
+        SELECT LOWER(email) FROM signups WHERE workshop_id = ? AND status != 'expired'
+    `, workshop.ID)
+	if err != nil {
+		log.Printf("Error loading existing signups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing signups"})
+		return
+	}
+	for emailRows.Next() {
+		var email string
+		emailRows.Scan(&email)
+		existing[email] = true
+	}
+	emailRows.Close()
+
+	paymentStatus := PaymentPending
+	if workshop.PriceCents == 0 {
+		paymentStatus = PaymentPaid
+	}
+
+	var rows []ImportRow
+	var valid []SignupForm
+	for i, record := range file.Records {
+		row := ImportRow{Line: i + 2, Raw: file.Raw[i]}
+
+		form := SignupForm{
+			WorkshopID: workshop.ID,
+			FirstName:  record["first_name"],
+			LastName:   record["last_name"],
+			Email:      record["email"],
+			Phone:      record["phone"],
+		}
+		if err := binding.Validator.ValidateStruct(&form); err != nil {
+			row.Errors = append(row.Errors, rowErrors(&form, err)...)
+		}
+		country := record["country_code"]
+		if country == "" {
+			country = defaultPhoneCountry
+		}
+		phone, err := normalizePhone(country, form.Phone)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("phone is not a valid number for %s", country))
+		}
+		form.Phone = phone
+
+		email := strings.ToLower(form.Email)
+		if existing[email] {
+			row.Errors = append(row.Errors, "already signed up for this workshop")
+		}
+		if len(row.Errors) == 0 && taken+len(valid) >= workshop.MaxCapacity {
+			row.Errors = append(row.Errors, "workshop is full")
+		}
+
+		if len(row.Errors) == 0 {
+			existing[email] = true
+			valid = append(valid, form)
+		}
+		rows = append(rows, row)
+	}
+
+	invalid := len(rows) - len(valid)
+	if !commit || (invalid > 0 && !skipInvalid) {
+		c.HTML(http.StatusOK, "import_preview.html", gin.H{
+			"Kind":        "signups",
+			"Action":      "/admin/import/signups",
+			"Workshop":    workshop,
+			"Rows":        rows,
+			"Valid":       len(valid),
+			"Invalid":     invalid,
+			"CSV":         raw,
+			"SkipInvalid": skipInvalid,
+			"Committed":   commit,
+		})
+		return
+	}
+
+	for _, form := range valid {
+		participantID, err := upsertParticipant(tx, form.FirstName, form.LastName, form.Email, form.Phone)
+		if err != nil {
+			log.Printf("Error saving participant: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing signups"})
+			return
+		}
+
+		_, err = tx.Exec(`
+            INSERT INTO signups (workshop_id, first_name, last_name, email, phone, status,
+                                 price_cents, payment_status, participant_id)
+            VALUES (?, ?, ?, ?, ?, 'confirmed', ?, ?, ?)
+        `, workshop.ID, form.FirstName, form.LastName, form.Email, form.Phone,
+			workshop.PriceCents, paymentStatus, participantID)
+		if err != nil {
+			log.Printf("Error importing signup: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing signups"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing signup import: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing signups"})
+		return
+	}
+
+	log.Printf("✓ Imported %d signups into workshop %d", len(valid), workshop.ID)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin?workshop=%d&imported=%d", workshop.ID, len(valid)))
+}
+
+// workshopImportRow carries the same rules as the create workshop form
+type workshopImportRow struct {
+	Title       string `form:"title" binding:"required"`
+	Description string `form:"description" binding:"required"`
+	Date        string `form:"date" binding:"required"`
+	Time        string `form:"time" binding:"required"`
+	Location    string `form:"location" binding:"required"`
+	MaxCapacity int    `form:"max_capacity" binding:"required,min=1"`
+	Currency    string `form:"currency" binding:"omitempty,oneof=CHF EUR"`
+}
+
+// ImportWorkshopsHandler is the workshop counterpart of ImportSignupsHandler
+func (h *Handlers) ImportWorkshopsHandler(c *gin.Context) {
+	raw, file, err := readImportCSV(c)
+	if err != nil {
+		importError(c, err.Error())
+		return
+	}
+
+	commit := c.PostForm("commit") == "true"
+	skipInvalid := c.PostForm("skip_invalid") == "true"
+
+	type validWorkshop struct {
+		Workshop Workshop
+		StartsAt time.Time
+	}
+
+	var rows []ImportRow
+	var valid []validWorkshop
+	for i, record := range file.Records {
+		row := ImportRow{Line: i + 2, Raw: file.Raw[i]}
+
+		form := workshopImportRow{
+			Title:       record["title"],
+			Description: record["description"],
+			Date:        record["date"],
+			Time:        record["time"],
+			Location:    record["location"],
+			Currency:    strings.ToUpper(record["currency"]),
+		}
+		if capacity := record["max_capacity"]; capacity != "" {
+			form.MaxCapacity, err = strconv.Atoi(capacity)
+			if err != nil {
+				row.Errors = append(row.Errors, "max_capacity is not a number")
+			}
+		}
+		if err := binding.Validator.ValidateStruct(&form); err != nil {
+			row.Errors = append(row.Errors, rowErrors(&form, err)...)
+		}
+
+		startsAt, err := time.ParseInLocation(startsAtLayout, form.Date+" "+form.Time, time.Local)
+		if err != nil && form.Date != "" && form.Time != "" {
+			row.Errors = append(row.Errors, "date or time is invalid, use YYYY-MM-DD and HH:MM")
+		}
+		priceCents, err := parsePriceCents(record["price"])
+		if err != nil {
+			row.Errors = append(row.Errors, "price is invalid")
+		}
+		if form.Currency == "" {
+			form.Currency = "CHF"
+		}
+
+		if len(row.Errors) == 0 {
+			valid = append(valid, validWorkshop{
+				Workshop: Workshop{
+					Title:       form.Title,
+					Description: form.Description,
+					Location:    form.Location,
+					MaxCapacity: form.MaxCapacity,
+					PriceCents:  priceCents,
+					Currency:    form.Currency,
+				},
+				StartsAt: startsAt,
+			})
+		}
+		rows = append(rows, row)
+	}
+
+	invalid := len(rows) - len(valid)
+	if !commit || (invalid > 0 && !skipInvalid) {
+		c.HTML(http.StatusOK, "import_preview.html", gin.H{
+			"Kind":        "workshops",
+			"Action":      "/admin/import/workshops",
+			"Rows":        rows,
+			"Valid":       len(valid),
+			"Invalid":     invalid,
+			"CSV":         raw,
+			"SkipInvalid": skipInvalid,
+			"Committed":   commit,
+		})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting import transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing workshops"})
+		return
+	}
+	defer tx.Rollback()
+
+	for _, w := range valid {
+		if _, err := insertWorkshop(tx, w.Workshop, w.StartsAt); err != nil {
+			log.Printf("Error importing workshop: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing workshops"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing workshop import: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing workshops"})
+		return
+	}
+
+	log.Printf("✓ Imported %d workshops", len(valid))
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/import?imported=%d", len(valid)))
+}
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"log"
+	"html/template"
+	"log/slog"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -10,12 +11,7 @@ import (
 
 func main() {
 	// Load .env file (only in development)
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("⚠️  Warning: .env file not found (this is normal in production)")
-	} else {
-		log.Println("✓ .env file loaded")
-	}
+	envErr := godotenv.Load()
 
 	// Set Gin mode based on environment
 	mode := os.Getenv("GIN_MODE")
@@ -23,6 +19,14 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Logging needs GIN_MODE and LOG_LEVEL, which may come from .env
+	setupLogging()
+	if envErr != nil {
+		slog.Debug(".env file not found, this is normal in production")
+	} else {
+		slog.Info(".env file loaded")
+	}
+
 	// Initialize database
 	db := initDB()
 	defer db.Close()
@@ -30,11 +34,46 @@ func main() {
 	// Set DB for middleware
 	SetDB(db)
 
+	// Free seats whose payment never completed
+	startHoldSweeper(db)
+
+	// Send queued bulk email at the pace our SMTP provider allows
+	startOutboxWorker(db)
+
+	// Anonymize participant details once the retention period is over
+	startRetentionSweeper(db)
+
+	// Prometheus metrics, on a port of their own
+	startMetricsServer()
+
 	// Create Gin router
-	r := gin.Default()
+	r := gin.New()
+	// Lets slog find the request ID when handlers log with the gin context
+	r.ContextWithFallback = true
+	// Fly's proxy sets Fly-Client-IP; X-Forwarded-For can be sent by anyone,
+	// which would let spammers dodge the signup rate limit
+	r.TrustedPlatform = gin.PlatformFlyIO
+	if err := r.SetTrustedProxies(nil); err != nil {
+		fatal("Failed to configure trusted proxies", err)
+	}
+	r.Use(RequestID(), RequestLogger(), HTTPMetrics(), Recovery())
 
 	// Load templates
+	r.SetFuncMap(template.FuncMap{
+		"formatMoney":  formatMoney,
+		"formatAmount": formatAmount,
+		"add":          func(a, b int) int { return a + b },
+		"t":            translate,
+		"formatPhone":  formatPhone,
+		"phoneCountries": func() []PhoneCountry {
+			return phoneCountries
+		},
+		"defaultPhoneCountry": func() string {
+			return defaultPhoneCountry
+		},
+	})
 	r.LoadHTMLGlob("templates/*")
+	loadCatalogs("locales")
 
 	// Serve static files
 	r.Static("/static", "./static")
@@ -45,11 +84,26 @@ func main() {
 	// Public routes
 	r.GET("/", handlers.HomeHandler)
 	r.POST("/signup", handlers.SignupHandler)
+	r.GET("/signup/verify", handlers.VerifySignupHandler)
+	r.POST("/signup/verify", handlers.VerifySignupHandler)
+	r.POST("/stripe/webhook", handlers.StripeWebhookHandler)
+	r.GET("/payment/cancel", handlers.CheckoutCancelHandler)
+	r.GET("/newsletter/confirm", handlers.NewsletterConfirmHandler)
+	r.GET("/newsletter/unsubscribe", handlers.NewsletterUnsubscribeHandler)
+	r.POST("/newsletter/unsubscribe", handlers.NewsletterUnsubscribeHandler)
+	r.GET("/courses/:id", handlers.CourseHandler)
+	r.POST("/courses/:id/signup", handlers.CourseSignupHandler)
+	r.GET("/privacy", handlers.PrivacyHandler)
+	r.POST("/privacy", handlers.PrivacyRequestHandler)
+	r.GET("/privacy/manage", handlers.PrivacyManageHandler)
+	r.GET("/privacy/export", handlers.PrivacyExportHandler)
+	r.POST("/privacy/erase", handlers.PrivacyEraseHandler)
 
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Health checks: liveness, and readiness which checks the database,
+	// storage and email. /health is kept for existing monitors.
+	r.GET("/healthz", handlers.HealthzHandler)
+	r.GET("/health", handlers.HealthzHandler)
+	r.GET("/readyz", handlers.ReadyzHandler)
 
 	// Admin routes with basic auth
 	admin := r.Group("/admin")
@@ -57,8 +111,45 @@ func main() {
 	{
 		admin.GET("", handlers.AdminHandler)
 		admin.POST("create-workshop", handlers.CreateWorkshopHandler)
+		admin.GET("workshops/:id/edit", handlers.EditWorkshopHandler)
+		admin.POST("workshops/:id", handlers.UpdateWorkshopHandler)
+		admin.GET("workshops/:id/roster.pdf", handlers.RosterPDFHandler)
+		admin.GET("workshops/:id/broadcast", handlers.BroadcastHandler)
+		admin.POST("workshops/:id/broadcast", handlers.SendBroadcastHandler)
+		admin.GET("broadcasts/:id", handlers.BroadcastStatusHandler)
+		admin.POST("broadcasts/:id/retry", handlers.RetryBroadcastHandler)
 		admin.POST("change-password", handlers.ChangePasswordHandler)
+		admin.GET("newsletter", handlers.AdminNewsletterHandler)
+		admin.POST("newsletter", handlers.SendNewsletterHandler)
+		admin.GET("participants", handlers.ParticipantsHandler)
+		admin.GET("participants/:id", handlers.ParticipantHandler)
+		admin.POST("participants/:id/merge", handlers.MergeParticipantHandler)
+		admin.GET("consents", handlers.AdminConsentsHandler)
+		admin.POST("consents", handlers.CreateConsentPolicyHandler)
+		admin.POST("consents/:id", handlers.UpdateConsentPolicyHandler)
+		admin.GET("spam", handlers.AdminSpamHandler)
+		admin.GET("privacy", handlers.AdminPrivacyHandler)
+		admin.GET("privacy/export", handlers.AdminPrivacyExportHandler)
+		admin.POST("privacy/erase", handlers.AdminPrivacyEraseHandler)
+		admin.POST("privacy/retention", handlers.RunRetentionHandler)
+		admin.GET("import", handlers.ImportHandler)
+		admin.POST("import/signups", handlers.ImportSignupsHandler)
+		admin.POST("import/workshops", handlers.ImportWorkshopsHandler)
+		admin.GET("export", handlers.ExportFormHandler)
 		admin.GET("export-csv", handlers.ExportCSVHandler)
+		admin.GET("courses", handlers.AdminCoursesHandler)
+		admin.POST("courses", handlers.CreateCourseHandler)
+		admin.GET("courses/:id", handlers.AdminCourseHandler)
+		admin.POST("courses/:id/attendance", handlers.MarkAttendanceHandler)
+		admin.GET("checkin/:workshopID", handlers.CheckinHandler)
+		admin.POST("checkin/:workshopID", handlers.CheckinSubmitHandler)
+		admin.GET("signups/:id", handlers.SignupPaymentHandler)
+		admin.POST("signups/:id/payment", handlers.RecordPaymentHandler)
+		admin.POST("signups/:id/refunds", handlers.RecordRefundHandler)
+		admin.POST("discount-codes", handlers.CreateDiscountCodeHandler)
+		admin.POST("discount-codes/delete", handlers.DeleteDiscountCodeHandler)
+		admin.POST("price-tiers", handlers.CreatePriceTierHandler)
+		admin.POST("price-tiers/delete", handlers.DeletePriceTierHandler)
 	}
 
 	// Get port from environment or use default
@@ -67,6 +158,6 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s\n", port)
-	log.Fatal(r.Run(":" + port))
+	slog.Info("Server starting", "port", port)
+	fatal("Server stopped", r.Run(":"+port))
 }
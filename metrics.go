@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are served in the Prometheus format on their own port, see
+// startMetricsServer, so they never go through the public proxy.
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to answer HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	signupOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signups_total",
+		Help: "Signup attempts by form and outcome.",
+	}, []string{"form", "outcome"})
+
+	emailSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_sends_total",
+		Help: "Emails handed to the SMTP server, by result.",
+	}, []string{"result"})
+
+	emailDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "email_send_duration_seconds",
+		Help:    "Time taken to send an email over SMTP.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time taken by database statements, by kind of statement.",
+		Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1},
+	}, []string{"operation"})
+
+	dbErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_errors_total",
+		Help: "Database statements that failed, by kind of statement.",
+	}, []string{"operation"})
+)
+
+// Signup outcomes
+const (
+	signupSuccess         = "success"
+	signupFull            = "full"
+	signupValidationError = "validation_error"
+	signupSpam            = "spam"
+	signupError           = "error"
+)
+
+// countSignup records how a signup attempt ended. An empty outcome isn't
+// counted, e.g. when the form only redirects elsewhere.
+func countSignup(form string, outcome *string) {
+	if *outcome != "" {
+		signupOutcomes.WithLabelValues(form, *outcome).Inc()
+	}
+}
+
+// HTTPMetrics counts requests and their duration per route. Requests that
+// match no route share one label, so scanners can't blow up the series.
+func HTTPMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeEmail records one SMTP delivery
+func observeEmail(start time.Time, err error) {
+	emailDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		emailSends.WithLabelValues("failure").Inc()
+	} else {
+		emailSends.WithLabelValues("success").Inc()
+	}
+}
+
+// startMetricsServer serves /metrics on METRICS_PORT, 9091 by default. Fly
+// scrapes it from inside its network, see [metrics] in fly.toml.
+func startMetricsServer() {
+	port := os.Getenv("METRICS_PORT")
+	if port == "" {
+		port = "9091"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(":"+port, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err, "port", port)
+		}
+	}()
+	slog.Info("Serving metrics", "port", port)
+}
+
+// The database is opened through a driver that times every statement. It's
+// the SQLite driver with the connection's Exec and Query wrapped.
+const instrumentedDriver = "sqlite3_instrumented"
+
+func init() {
+	sql.Register(instrumentedDriver, instrumentedSQLite{&sqlite3.SQLiteDriver{}})
+}
+
+type instrumentedSQLite struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d instrumentedSQLite) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type instrumentedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	observeStatement(queryOperation(query), start, err)
+	return result, err
+}
+
+// QueryContext only prepares the statement, SQLite does the work while the
+// rows are read, so the time is taken when they're closed
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		observeStatement(queryOperation(query), start, err)
+		return nil, err
+	}
+	return &instrumentedRows{SQLiteRows: rows.(*sqlite3.SQLiteRows), operation: queryOperation(query), start: start}, nil
+}
+
+type instrumentedRows struct {
+	*sqlite3.SQLiteRows
+	operation string
+	start     time.Time
+	err       error
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.SQLiteRows.Next(dest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.SQLiteRows.Close()
+	observeStatement(r.operation, r.start, errors.Join(r.err, err))
+	return err
+}
+
+func observeStatement(operation string, start time.Time, err error) {
+	dbDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		dbErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// queryOperation is the statement's first keyword, e.g. select or insert
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	keyword := strings.ToLower(fields[0])
+	switch keyword {
+	case "select", "insert", "update", "delete", "with":
+		return keyword
+	case "create", "alter", "drop", "pragma":
+		return "schema"
+	default:
+		return "other"
+	}
+}
@@ -1,29 +1,224 @@
 package main
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Signup statuses. Only confirmed signups and unexpired holds take a seat.
+const (
+	SignupConfirmed      = "confirmed"
+	SignupPendingPayment = "pending_payment"
+	// Waiting for the participant to click the link in the verification email
+	SignupPendingVerification = "pending_verification"
+	SignupExpired             = "expired"
+)
+
+// Payment statuses, tracked separately from whether the signup holds a seat
+const (
+	PaymentPending  = "pending"
+	PaymentPaid     = "paid"
+	PaymentRefunded = "refunded"
+	PaymentFailed   = "failed"
+)
+
+// Ways a fee can be paid, "stripe" is set by the Checkout webhook
+var paymentMethods = []string{"transfer", "cash", "twint", "stripe", "other"}
+
+const (
+	// Shown to participants, e.g. "Saturday, March 15, 2025 at 6:00 PM"
+	workshopDateLayout = "Monday, January 2, 2006 at 3:04 PM"
+	// Local start time as stored in workshops.starts_at, sorts chronologically
+	startsAtLayout = "2006-01-02 15:04"
+)
+
 type Workshop struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Date        string `json:"date"`
-	Location    string `json:"location"`
-	SignupCount int    `json:"signup_count"`
-	MaxCapacity int    `json:"max_capacity"`
+	ID                 int    `json:"id"`
+	Title              string `json:"title"`
+	Description        string `json:"description"`
+	Date               string `json:"date"`
+	Location           string `json:"location"`
+	SignupCount        int    `json:"signup_count"`
+	MaxCapacity        int    `json:"max_capacity"`
+	MaxSeatsPerBooking int    `json:"max_seats_per_booking"` // e.g. to bring a friend along
+	PriceCents         int    `json:"price_cents"`
+	Currency           string `json:"currency"`
+	StartsAt           string `json:"starts_at"`
+	SeriesID           int    `json:"series_id,omitempty"`
+	CourseID           int    `json:"course_id,omitempty"`
+	VerifyEmail        bool   `json:"verify_email"` // seats are only held until the email is verified
+}
+
+// IsPaid reports whether participants have to pay to attend.
+func (w Workshop) IsPaid() bool {
+	return w.PriceCents > 0
+}
+
+// FormattedPrice returns the price as shown to participants, e.g. "CHF 45.00".
+func (w Workshop) FormattedPrice() string {
+	return formatMoney(w.PriceCents, w.Currency)
 }
 
 type Signup struct {
-	ID         int    `json:"id"`
-	WorkshopID int    `json:"workshop_id"`
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	Email      string `json:"email" binding:"required,email"`
-	Phone      string `json:"phone"`
-	CreatedAt  string `json:"created_at"`
+	ID              int             `json:"id"`
+	WorkshopID      int             `json:"workshop_id"`
+	FirstName       string          `json:"first_name"`
+	LastName        string          `json:"last_name"`
+	Email           string          `json:"email" binding:"required,email"`
+	Phone           string          `json:"phone"`
+	Status          string          `json:"status"`
+	Seats           int             `json:"seats"`
+	Guests          []string        `json:"guests,omitempty"`
+	Language        string          `json:"language"`    // for the emails we send
+	PriceCents      int             `json:"price_cents"` // for all seats
+	DiscountCode    string          `json:"discount_code"`
+	PaymentStatus   string          `json:"payment_status"`
+	AmountPaidCents int             `json:"amount_paid_cents"`
+	PaymentMethod   string          `json:"payment_method"`
+	RefundedCents   int             `json:"refunded_cents"`
+	RefundDue       bool            `json:"refund_due"` // paid after the seat went to someone else
+	AttendedAt      string          `json:"attended_at"`
+	Answers         []SignupAnswer  `json:"answers,omitempty"`
+	Consents        []SignupConsent `json:"consents,omitempty"`
+	CreatedAt       string          `json:"created_at"`
+}
+
+// Participant is everyone who signed up with the same (normalized) email
+type Participant struct {
+	ID        int            `json:"id"`
+	Email     string         `json:"email"`
+	FirstName string         `json:"first_name"`
+	LastName  string         `json:"last_name"`
+	Phone     string         `json:"phone"`
+	Workshops int            `json:"workshops"`
+	Attended  int            `json:"attended"`
+	LastVisit string         `json:"last_visit"`
+	Spend     map[string]int `json:"spend"` // net cents per currency
+	CreatedAt string         `json:"created_at"`
+}
+
+// FormattedSpend lists the spend per currency, e.g. "CHF 120.00 · EUR 30.00"
+func (p Participant) FormattedSpend() string {
+	if len(p.Spend) == 0 {
+		return formatMoney(0, "CHF")
+	}
+	currencies := make([]string, 0, len(p.Spend))
+	for currency := range p.Spend {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	parts := make([]string, len(currencies))
+	for i, currency := range currencies {
+		parts[i] = formatMoney(p.Spend[currency], currency)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// Attendance summarises check-ins of a workshop's confirmed participants
+type Attendance struct {
+	Confirmed int `json:"confirmed"`
+	Attended  int `json:"attended"`
+	NoShows   int `json:"no_shows"`
+}
+
+// Course groups several workshops that people register for in one go
+type Course struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Location    string     `json:"location"`
+	MaxCapacity int        `json:"max_capacity"`
+	PriceCents  int        `json:"price_cents"` // for all sessions together
+	Currency    string     `json:"currency"`
+	Sessions    []Workshop `json:"sessions"`
+	Enrolled    int        `json:"enrolled"`
+}
+
+// IsPaid reports whether participants have to pay to enroll.
+func (c Course) IsPaid() bool {
+	return c.PriceCents > 0
+}
+
+// FormattedPrice returns the price as shown to participants, e.g. "CHF 180.00".
+func (c Course) FormattedPrice() string {
+	return formatMoney(c.PriceCents, c.Currency)
+}
+
+// SeatsLeft is limited by the fullest session, drop-in signups included
+func (c Course) SeatsLeft() int {
+	left := c.MaxCapacity
+	for _, s := range c.Sessions {
+		left = min(left, s.MaxCapacity-s.SignupCount)
+	}
+	return max(left, 0)
+}
+
+type CourseEnrollment struct {
+	ID        int    `json:"id"`
+	CourseID  int    `json:"course_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	CreatedAt string `json:"created_at"`
+	// Signup per session, keyed by workshop ID
+	Attendance map[int]SessionAttendance `json:"attendance"`
+}
+
+type SessionAttendance struct {
+	SignupID   int    `json:"signup_id"`
+	AttendedAt string `json:"attended_at,omitempty"`
+}
+
+type CourseSignupForm struct {
+	FirstName string `form:"first_name" binding:"required"`
+	LastName  string `form:"last_name" binding:"required"`
+	Email     string `form:"email" binding:"required,email"`
+	Phone     string `form:"phone" binding:"omitempty,max=30"`
+}
+
+type Refund struct {
+	ID          int    `json:"id"`
+	SignupID    int    `json:"signup_id"`
+	AmountCents int    `json:"amount_cents"`
+	Note        string `json:"note"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// PaymentTotals sums up the money side of a workshop for the admin panel
+type PaymentTotals struct {
+	ExpectedCents    int
+	ReceivedCents    int
+	RefundedCents    int
+	OutstandingCents int
+}
+
+// NetCents is what was received minus what was paid back
+func (t PaymentTotals) NetCents() int {
+	return t.ReceivedCents - t.RefundedCents
 }
 
 type SignupForm struct {
-	WorkshopID int    `form:"workshop_id" binding:"required"`
-	FirstName  string `form:"first_name" binding:"required"`
-	LastName   string `form:"last_name" binding:"required"`
-	Email      string `form:"email" binding:"required,email"`
-	Phone      string `form:"phone" binding:"omitempty,min=10"`
+	WorkshopID   int    `form:"workshop_id" binding:"required"`
+	FirstName    string `form:"first_name" binding:"required"`
+	LastName     string `form:"last_name" binding:"required"`
+	Email        string `form:"email" binding:"required,email"`
+	Phone        string `form:"phone" binding:"omitempty,max=30"`
+	DiscountCode string `form:"discount_code" binding:"omitempty,max=32"`
+	Newsletter   bool   `form:"newsletter"`
+	Seats        int    `form:"seats" binding:"omitempty,min=1,max=10"`
+}
+
+func formatMoney(cents int, currency string) string {
+	if cents < 0 {
+		return "-" + formatMoney(-cents, currency)
+	}
+	return fmt.Sprintf("%s %d.%02d", currency, cents/100, cents%100)
+}
+
+// formatAmount returns cents as a plain decimal for form inputs, e.g. "45.00"
+func formatAmount(cents int) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
 }
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Subscription statuses. Only confirmed (double opt-in) addresses get mail.
+const (
+	NewsletterPending      = "pending"
+	NewsletterSubscribed   = "subscribed"
+	NewsletterUnsubscribed = "unsubscribed"
+)
+
+const (
+	newsletterConfirmPurpose     = "newsletter-confirm"
+	newsletterUnsubscribePurpose = "newsletter-unsubscribe"
+)
+
+// Newsletter is one announcement sent to all subscribers
+type Newsletter struct {
+	ID         int
+	Subject    string
+	Body       string
+	WorkshopID int
+	Recipients int
+	Sent       int
+	Failed     int
+	CreatedAt  string
+}
+
+func (h *Handlers) newsletterLink(c *gin.Context, path, purpose, email string) string {
+	token := signToken(h.signingKey, purpose, normalizeEmail(email))
+	return fmt.Sprintf("%s%s?token=%s", baseURL(c), path, url.QueryEscape(token))
+}
+
+// requestNewsletterOptIn records the wish to subscribe and sends the
+// confirmation link. Nothing is sent to people who are already subscribed.
+func (h *Handlers) requestNewsletterOptIn(c *gin.Context, firstName, email string) {
+	result, err := h.db.Exec(`
+        INSERT INTO newsletter_subscriptions (email, first_name, status)
+        VALUES (?, ?, 'pending')
+        ON CONFLICT (email) DO UPDATE SET
+            status = 'pending', first_name = excluded.first_name, requested_at = CURRENT_TIMESTAMP
+        WHERE newsletter_subscriptions.status != 'subscribed'
+    `, normalizeEmail(email), firstName)
+	if err != nil {
+		log.Printf("Error saving newsletter opt-in: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return
+	}
+
+	confirmURL := h.newsletterLink(c, "/newsletter/confirm", newsletterConfirmPurpose, email)
+	go sendNewsletterOptInEmail(firstName, email, confirmURL)
+}
+
+// NewsletterConfirmHandler is the link in the opt-in email
+func (h *Handlers) NewsletterConfirmHandler(c *gin.Context) {
+	email, ok := verifyToken(h.signingKey, newsletterConfirmPurpose, c.Query("token"))
+	if !ok {
+		c.HTML(http.StatusBadRequest, "newsletter.html", gin.H{
+			"Error": "This confirmation link is invalid. Please copy the whole link from the email.",
+		})
+		return
+	}
+
+	_, err := h.db.Exec(`
+        UPDATE newsletter_subscriptions SET status = 'subscribed', confirmed_at = CURRENT_TIMESTAMP
+        WHERE email = ? AND status = 'pending'
+    `, email)
+	if err != nil {
+		log.Printf("Error confirming newsletter subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming subscription"})
+		return
+	}
+
+	var status string
+	h.db.QueryRow("SELECT status FROM newsletter_subscriptions WHERE email = ?", email).Scan(&status)
+	if status != NewsletterSubscribed {
+		c.HTML(http.StatusOK, "newsletter.html", gin.H{
+			"Error": "This subscription was cancelled. Sign up again to receive our news.",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "newsletter.html", gin.H{
+		"Message": "Thank you! You'll now hear about our upcoming workshops.",
+	})
+}
+
+// NewsletterUnsubscribeHandler asks before unsubscribing on GET, so link
+// scanners in mail filters don't unsubscribe people by visiting the link.
+// Mail clients' one-click unsubscribe POSTs straight away.
+func (h *Handlers) NewsletterUnsubscribeHandler(c *gin.Context) {
+	token := c.Query("token")
+	email, ok := verifyToken(h.signingKey, newsletterUnsubscribePurpose, token)
+	if !ok {
+		c.HTML(http.StatusBadRequest, "newsletter.html", gin.H{
+			"Error": "This unsubscribe link is invalid. Please copy the whole link from the email.",
+		})
+		return
+	}
+
+	if c.Request.Method == http.MethodGet {
+		c.HTML(http.StatusOK, "newsletter.html", gin.H{
+			"Unsubscribe": true,
+			"Email":       email,
+			"Token":       token,
+		})
+		return
+	}
+
+	_, err := h.db.Exec(`
+        UPDATE newsletter_subscriptions SET status = 'unsubscribed', unsubscribed_at = CURRENT_TIMESTAMP
+        WHERE email = ? AND status != 'unsubscribed'
+    `, email)
+	if err != nil {
+		log.Printf("Error unsubscribing from newsletter: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unsubscribing"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "newsletter.html", gin.H{
+		"Message": "You've been unsubscribed and won't receive any more announcements.",
+	})
+}
+
+// AdminNewsletterHandler shows subscriber numbers, past announcements with
+// their delivery state and the composer. ?workshop=ID prefills an
+// announcement for that workshop.
+func (h *Handlers) AdminNewsletterHandler(c *gin.Context) {
+	counts := map[string]int{}
+	rows, err := h.db.Query("SELECT status, COUNT(*) FROM newsletter_subscriptions GROUP BY status")
+	if err != nil {
+		log.Printf("Error counting subscribers: %v", err)
+	} else {
+		for rows.Next() {
+			var status string
+			var n int
+			if rows.Scan(&status, &n) == nil {
+				counts[status] = n
+			}
+		}
+		rows.Close()
+	}
+
+	var newsletters []Newsletter
+	rows, err = h.db.Query(`
+        SELECT n.id, n.subject, n.recipients, n.created_at,
+               COALESCE(SUM(o.status = 'sent'), 0), COALESCE(SUM(o.status = 'failed'), 0)
+        FROM newsletters n
+        LEFT JOIN email_outbox o ON o.kind = 'newsletter' AND o.reference_id = n.id
+        GROUP BY n.id
+        ORDER BY n.created_at DESC
+        LIMIT 20
+    `)
+	if err != nil {
+		log.Printf("Error loading newsletters: %v", err)
+	} else {
+		for rows.Next() {
+			var n Newsletter
+			if err := rows.Scan(&n.ID, &n.Subject, &n.Recipients, &n.CreatedAt, &n.Sent, &n.Failed); err != nil {
+				log.Printf("Error scanning newsletter row: %v", err)
+				continue
+			}
+			newsletters = append(newsletters, n)
+		}
+		rows.Close()
+	}
+
+	workshops, err := h.listWorkshops()
+	if err != nil {
+		log.Printf("Error listing workshops: %v", err)
+	}
+
+	// Prefill the announcement from the chosen workshop
+	var subject, body string
+	var workshopID int
+	if id := c.Query("workshop"); id != "" {
+		var w Workshop
+		err := h.db.QueryRow(`
+            SELECT id, title, description, date, location FROM workshops WHERE id = ?
+        `, id).Scan(&w.ID, &w.Title, &w.Description, &w.Date, &w.Location)
+		if err == nil {
+			workshopID = w.ID
+			subject = "New workshop: " + w.Title
+			body = fmt.Sprintf("%s\n\n📅 %s\n📍 %s\n\n%s\n\nSign up here: %s/\n",
+				w.Title, w.Date, w.Location, w.Description, baseURL(c))
+		}
+	}
+
+	c.HTML(http.StatusOK, "admin_newsletter.html", gin.H{
+		"Subscribed":   counts[NewsletterSubscribed],
+		"Pending":      counts[NewsletterPending],
+		"Unsubscribed": counts[NewsletterUnsubscribed],
+		"Newsletters":  newsletters,
+		"Workshops":    workshops,
+		"WorkshopID":   workshopID,
+		"Subject":      subject,
+		"Body":         body,
+		"Queued":       c.Query("queued"),
+		"Error":        c.Query("newsletter_error"),
+		"EmailEnabled": emailConfigured(),
+	})
+}
+
+// SendNewsletterHandler queues the announcement for every confirmed
+// subscriber, each with a personal unsubscribe link
+func (h *Handlers) SendNewsletterHandler(c *gin.Context) {
+	var form struct {
+		Subject    string `form:"subject" binding:"required,max=200"`
+		Body       string `form:"body" binding:"required"`
+		WorkshopID int    `form:"workshop_id"`
+	}
+	if err := c.ShouldBind(&form); err != nil {
+		c.Redirect(http.StatusSeeOther, "/admin/newsletter?newsletter_error="+
+			url.QueryEscape("Please fill in subject and message"))
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting newsletter transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending newsletter"})
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+        SELECT email FROM newsletter_subscriptions WHERE status = 'subscribed' ORDER BY id
+    `)
+	if err != nil {
+		log.Printf("Error loading subscribers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending newsletter"})
+		return
+	}
+	var recipients []string
+	for rows.Next() {
+		var email string
+		if rows.Scan(&email) == nil {
+			recipients = append(recipients, email)
+		}
+	}
+	rows.Close()
+
+	if len(recipients) == 0 {
+		c.Redirect(http.StatusSeeOther, "/admin/newsletter?newsletter_error="+
+			url.QueryEscape("There are no confirmed subscribers yet"))
+		return
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO newsletters (subject, body, workshop_id, recipients) VALUES (?, ?, ?, ?)
+    `, form.Subject, form.Body, nullableID(form.WorkshopID), len(recipients))
+	if err != nil {
+		log.Printf("Error saving newsletter: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending newsletter"})
+		return
+	}
+	newsletterID, _ := result.LastInsertId()
+
+	body := strings.ReplaceAll(strings.TrimSpace(form.Body), "\r\n", "\n")
+	for _, email := range recipients {
+		unsubscribeURL := h.newsletterLink(c, "/newsletter/unsubscribe", newsletterUnsubscribePurpose, email)
+		err := queueEmail(tx, OutboxMessage{
+			ToEmail: email,
+			Subject: form.Subject,
+			TextBody: body + "\n\n--\nYou're receiving this because you asked to hear about our workshops.\n" +
+				"Unsubscribe: " + unsubscribeURL + "\n",
+			UnsubscribeURL: unsubscribeURL,
+			Kind:           "newsletter",
+			ReferenceID:    int(newsletterID),
+		})
+		if err != nil {
+			log.Printf("Error queueing newsletter: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending newsletter"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing newsletter: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending newsletter"})
+		return
+	}
+
+	log.Printf("✓ Newsletter %d queued for %d subscribers", newsletterID, len(recipients))
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/newsletter?queued=%d", len(recipients)))
+}
+
+// sendNewsletterOptInEmail asks the subscriber to confirm. It's transactional,
+// so it goes out right away instead of through the outbox.
+func sendNewsletterOptInEmail(firstName, email, confirmURL string) error {
+	if !emailConfigured() {
+		return nil
+	}
+
+	body := fmt.Sprintf(`
+Dear %s,
+
+You asked to hear about our upcoming workshops. Please confirm by opening
+this link:
+
+%s
+
+If this wasn't you, simply ignore this email and you won't hear from us.
+
+Namaste 🙏
+    `, firstName, confirmURL)
+
+	if err := sendEmail(email, "Please confirm your subscription", body, "", ""); err != nil {
+		log.Printf("Failed to send newsletter confirmation email: %v", err)
+		return err
+	}
+
+	log.Println("✓ Newsletter confirmation email sent")
+	return nil
+}
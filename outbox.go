@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Outbox statuses
+const (
+	OutboxQueued = "queued"
+	OutboxSent   = "sent"
+	OutboxFailed = "failed"
+)
+
+// Failed sends are retried with a growing delay before giving up
+const maxOutboxAttempts = 5
+
+// OutboxMessage is an email waiting to be sent, or a record of one that was
+type OutboxMessage struct {
+	ID             int
+	ToEmail        string
+	Subject        string
+	TextBody       string
+	HTMLBody       string
+	UnsubscribeURL string
+	Kind           string // e.g. newsletter, so the admin can show delivery per campaign
+	ReferenceID    int
+	SignupID       int
+	Priority       int // higher goes first, e.g. a room change before a newsletter
+	Status         string
+	Attempts       int
+	LastError      string
+	CreatedAt      string
+	SentAt         string
+}
+
+// queueEmail adds a message to the outbox. Bulk mail goes through here so
+// the worker can pace it to what the SMTP provider allows.
+func queueEmail(db execer, m OutboxMessage) error {
+	_, err := db.Exec(`
+        INSERT INTO email_outbox (to_email, subject, text_body, html_body, unsubscribe_url,
+                                  kind, reference_id, signup_id, priority)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, m.ToEmail, m.Subject, m.TextBody, m.HTMLBody, m.UnsubscribeURL, m.Kind,
+		nullableID(m.ReferenceID), nullableID(m.SignupID), m.Priority)
+	return err
+}
+
+// outboxRateFromEnv is how many emails per minute we may send, set with
+// SMTP_RATE_PER_MINUTE. Most shared SMTP plans allow a few dozen.
+func outboxRateFromEnv() int {
+	rate, err := strconv.Atoi(os.Getenv("SMTP_RATE_PER_MINUTE"))
+	if err != nil || rate < 1 {
+		return 20
+	}
+	return rate
+}
+
+// startOutboxWorker sends queued emails one at a time, spread evenly over
+// each minute so we never exceed the provider's rate limit
+func startOutboxWorker(db *sql.DB) {
+	rate := outboxRateFromEnv()
+	go func() {
+		ticker := time.NewTicker(time.Minute / time.Duration(rate))
+		defer ticker.Stop()
+		warned := false
+		for range ticker.C {
+			if !emailConfigured() {
+				if !warned {
+					log.Println("⚠️  Email not configured, outbox messages stay queued")
+					warned = true
+				}
+				continue
+			}
+			sendNextQueuedEmail(db)
+		}
+	}()
+	log.Printf("✓ Email outbox sending up to %d emails per minute", rate)
+}
+
+func sendNextQueuedEmail(db *sql.DB) {
+	var m OutboxMessage
+	err := db.QueryRow(`
+        SELECT id, to_email, subject, text_body, COALESCE(html_body, ''), COALESCE(unsubscribe_url, ''),
+               attempts
+        FROM email_outbox
+        WHERE status = 'queued' AND next_attempt_at <= datetime('now')
+        ORDER BY priority DESC, id
+        LIMIT 1
+    `).Scan(&m.ID, &m.ToEmail, &m.Subject, &m.TextBody, &m.HTMLBody, &m.UnsubscribeURL, &m.Attempts)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading queued email: %v", err)
+		return
+	}
+
+	if err := sendEmail(m.ToEmail, m.Subject, m.TextBody, m.HTMLBody, m.UnsubscribeURL); err != nil {
+		m.Attempts++
+		status := OutboxQueued
+		if m.Attempts >= maxOutboxAttempts {
+			status = OutboxFailed
+		}
+		log.Printf("Failed to send queued email %d (attempt %d): %v", m.ID, m.Attempts, err)
+
+		// Back off 5, 10, 20, 40 minutes
+		retryAt := time.Now().UTC().Add(5 * time.Minute << (m.Attempts - 1))
+		_, err = db.Exec(`
+            UPDATE email_outbox SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?
+            WHERE id = ?
+        `, status, m.Attempts, err.Error(), retryAt.Format(sqliteTimeLayout), m.ID)
+		if err != nil {
+			log.Printf("Error updating queued email %d: %v", m.ID, err)
+		}
+		return
+	}
+
+	_, err = db.Exec(`
+        UPDATE email_outbox SET status = 'sent', attempts = attempts + 1, sent_at = datetime('now'),
+                                last_error = NULL
+        WHERE id = ?
+    `, m.ID)
+	if err != nil {
+		log.Printf("Error updating sent email %d: %v", m.ID, err)
+	}
+}
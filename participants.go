@@ -0,0 +1,298 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// normalizeEmail is the key participants are matched by
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// upsertParticipant returns the participant for this email, creating it on
+// the first signup. Later signups update the name and phone we have on file.
+func upsertParticipant(q queryRower, firstName, lastName, email, phone string) (int64, error) {
+	var id int64
+	err := q.QueryRow(`
+        INSERT INTO participants (email, first_name, last_name, phone)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (email) DO UPDATE SET
+            first_name = excluded.first_name,
+            last_name = excluded.last_name,
+            phone = COALESCE(NULLIF(excluded.phone, ''), participants.phone)
+        RETURNING id
+    `, normalizeEmail(email), firstName, lastName, phone).Scan(&id)
+	return id, err
+}
+
+// participantStats fills in workshop counts, last visit and spend. Last visit
+// is the latest workshop that already took place with a confirmed seat.
+const participantStatsQuery = `
+    SELECT p.id, p.email, p.first_name, p.last_name, COALESCE(p.phone, ''), p.created_at,
+           COALESCE(SUM(s.status = 'confirmed'), 0),
+           COALESCE(SUM(s.attended_at IS NOT NULL), 0),
+           COALESCE(MAX(CASE WHEN s.status = 'confirmed' AND w.starts_at <= ? THEN w.starts_at END), '')
+    FROM participants p
+    LEFT JOIN signups s ON s.participant_id = p.id
+    LEFT JOIN workshops w ON w.id = s.workshop_id
+`
+
+func scanParticipant(rows interface{ Scan(...any) error }) (Participant, error) {
+	var p Participant
+	err := rows.Scan(&p.ID, &p.Email, &p.FirstName, &p.LastName, &p.Phone, &p.CreatedAt,
+		&p.Workshops, &p.Attended, &p.LastVisit)
+	if err == nil && p.LastVisit != "" {
+		if t, err := time.ParseInLocation(startsAtLayout, p.LastVisit, time.Local); err == nil {
+			p.LastVisit = t.Format("Jan 2, 2006")
+		}
+	}
+	return p, err
+}
+
+// loadSpend adds up paid minus refunded amounts per currency for the given
+// participants
+func (h *Handlers) loadSpend(participants []Participant) error {
+	byID := map[int]*Participant{}
+	for i := range participants {
+		byID[participants[i].ID] = &participants[i]
+	}
+
+	rows, err := h.db.Query(`
+        SELECT s.participant_id, w.currency,
+               SUM(s.amount_paid_cents) -
+               COALESCE(SUM((SELECT SUM(amount_cents) FROM refunds WHERE signup_id = s.id)), 0)
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.participant_id IS NOT NULL
+        GROUP BY s.participant_id, w.currency
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, cents int
+		var currency string
+		if err := rows.Scan(&id, &currency, &cents); err != nil {
+			return err
+		}
+		if p, ok := byID[id]; ok && cents != 0 {
+			if p.Spend == nil {
+				p.Spend = map[string]int{}
+			}
+			p.Spend[currency] = cents
+		}
+	}
+	return rows.Err()
+}
+
+// ParticipantsHandler lists everyone who ever signed up, with search
+func (h *Handlers) ParticipantsHandler(c *gin.Context) {
+	search := strings.TrimSpace(c.Query("q"))
+	like := "%" + search + "%"
+
+	rows, err := h.db.Query(participantStatsQuery+`
+        WHERE ? = '' OR p.first_name || ' ' || p.last_name LIKE ? OR p.email LIKE ? OR p.phone LIKE ?
+        GROUP BY p.id
+        ORDER BY p.last_name COLLATE NOCASE, p.first_name COLLATE NOCASE
+    `, time.Now().Format(startsAtLayout), search, like, like, like)
+	if err != nil {
+		log.Printf("Error querying participants: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading participants: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var participants []Participant
+	for rows.Next() {
+		p, err := scanParticipant(rows)
+		if err != nil {
+			log.Printf("Error scanning participant row: %v", err)
+			continue
+		}
+		participants = append(participants, p)
+	}
+
+	if err := h.loadSpend(participants); err != nil {
+		log.Printf("Error loading participant spend: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "participants.html", gin.H{
+		"Participants": participants,
+		"Search":       search,
+	})
+}
+
+// ParticipantHandler shows one participant's history and merge options
+func (h *Handlers) ParticipantHandler(c *gin.Context) {
+	participantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Participant not found")
+		return
+	}
+
+	participant, err := scanParticipant(h.db.QueryRow(participantStatsQuery+`
+        WHERE p.id = ?
+        GROUP BY p.id
+    `, time.Now().Format(startsAtLayout), participantID))
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Participant not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading participant %d: %v", participantID, err)
+		c.String(http.StatusInternalServerError, "Error loading participant: %v", err)
+		return
+	}
+	participants := []Participant{participant}
+	if err := h.loadSpend(participants); err != nil {
+		log.Printf("Error loading participant spend: %v", err)
+	}
+	participant = participants[0]
+
+	rows, err := h.db.Query(`
+        SELECT s.id, s.status, s.payment_status, s.amount_paid_cents, COALESCE(s.attended_at, ''),
+               s.email, s.created_at, w.id, w.title, w.date, w.currency
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.participant_id = ?
+        ORDER BY w.starts_at DESC
+    `, participantID)
+	if err != nil {
+		log.Printf("Error loading participant history: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading participant: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type historyRow struct {
+		Signup   Signup
+		Workshop Workshop
+	}
+	var history []historyRow
+	for rows.Next() {
+		var r historyRow
+		err := rows.Scan(&r.Signup.ID, &r.Signup.Status, &r.Signup.PaymentStatus, &r.Signup.AmountPaidCents,
+			&r.Signup.AttendedAt, &r.Signup.Email, &r.Signup.CreatedAt,
+			&r.Workshop.ID, &r.Workshop.Title, &r.Workshop.Date, &r.Workshop.Currency)
+		if err != nil {
+			log.Printf("Error scanning participant history: %v", err)
+			continue
+		}
+		if r.Signup.AttendedAt != "" {
+			if t, err := parseDBTime(r.Signup.AttendedAt); err == nil {
+				r.Signup.AttendedAt = t.Local().Format(startsAtLayout)
+			}
+		}
+		history = append(history, r)
+	}
+
+	// Same name or phone under another email is most likely a typo
+	var duplicates []Participant
+	dupRows, err := h.db.Query(`
+        SELECT id, email, first_name, last_name, COALESCE(phone, '')
+        FROM participants
+        WHERE id != ?
+          AND ((first_name = ? COLLATE NOCASE AND last_name = ? COLLATE NOCASE)
+               OR (? != '' AND phone = ?))
+    `, participantID, participant.FirstName, participant.LastName, participant.Phone, participant.Phone)
+	if err != nil {
+		log.Printf("Error looking for duplicate participants: %v", err)
+	} else {
+		for dupRows.Next() {
+			var p Participant
+			if err := dupRows.Scan(&p.ID, &p.Email, &p.FirstName, &p.LastName, &p.Phone); err == nil {
+				duplicates = append(duplicates, p)
+			}
+		}
+		dupRows.Close()
+	}
+
+	c.HTML(http.StatusOK, "participant.html", gin.H{
+		"Participant": participant,
+		"History":     history,
+		"Duplicates":  duplicates,
+		"Merged":      c.Query("merged"),
+		"Error":       c.Query("merge_error"),
+	})
+}
+
+// MergeParticipantHandler folds a duplicate into this participant. The
+// duplicate's signups move over and take this participant's email address.
+func (h *Handlers) MergeParticipantHandler(c *gin.Context) {
+	participantID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Participant not found")
+		return
+	}
+
+	back := fmt.Sprintf("/admin/participants/%d", participantID)
+	mergeError := func(message string) {
+		c.Redirect(http.StatusSeeOther, back+"?merge_error="+url.QueryEscape(message))
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting participant merge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging participants"})
+		return
+	}
+	defer tx.Rollback()
+
+	var email string
+	if err := tx.QueryRow("SELECT email FROM participants WHERE id = ?", participantID).Scan(&email); err != nil {
+		c.String(http.StatusNotFound, "Participant not found")
+		return
+	}
+
+	// The duplicate comes either from the suggestions or typed in by email
+	var duplicateID int
+	if duplicateEmail := normalizeEmail(c.PostForm("duplicate_email")); duplicateEmail != "" {
+		err = tx.QueryRow("SELECT id FROM participants WHERE email = ?", duplicateEmail).Scan(&duplicateID)
+	} else {
+		err = tx.QueryRow("SELECT id FROM participants WHERE id = ?", c.PostForm("duplicate_id")).Scan(&duplicateID)
+	}
+	if err != nil {
+		mergeError("No such participant")
+		return
+	}
+	if duplicateID == participantID {
+		mergeError("Please choose another participant to merge")
+		return
+	}
+
+	result, err := tx.Exec(`
+        UPDATE signups SET participant_id = ?, email = ? WHERE participant_id = ?
+    `, participantID, email, duplicateID)
+	if err != nil {
+		log.Printf("Error moving signups of participant %d: %v", duplicateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging participants"})
+		return
+	}
+	moved, _ := result.RowsAffected()
+
+	if _, err := tx.Exec("DELETE FROM participants WHERE id = ?", duplicateID); err != nil {
+		log.Printf("Error deleting participant %d: %v", duplicateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging participants"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing participant merge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging participants"})
+		return
+	}
+
+	log.Printf("✓ Merged participant %d into %d", duplicateID, participantID)
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("%s?merged=%d", back, moved))
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// paymentTotals sums what a workshop's signups owe, paid and got refunded.
+// Expected and outstanding only count signups that hold a seat.
+func paymentTotals(q queryRower, workshopID int) (PaymentTotals, error) {
+	var t PaymentTotals
+	err := q.QueryRow(`
+        SELECT
+            COALESCE(SUM(CASE WHEN `+seatTakenCondition+` THEN price_cents ELSE 0 END), 0),
+            COALESCE(SUM(amount_paid_cents), 0),
+            COALESCE(SUM(CASE WHEN `+seatTakenCondition+` AND payment_status IN ('pending', 'failed')
+                         THEN MAX(price_cents - amount_paid_cents, 0) ELSE 0 END), 0)
+        FROM signups
+        WHERE workshop_id = ?
+    `, workshopID).Scan(&t.ExpectedCents, &t.ReceivedCents, &t.OutstandingCents)
+	if err != nil {
+		return t, err
+	}
+
+	err = q.QueryRow(`
+        SELECT COALESCE(SUM(r.amount_cents), 0)
+        FROM refunds r
+        JOIN signups s ON s.id = r.signup_id
+        WHERE s.workshop_id = ?
+    `, workshopID).Scan(&t.RefundedCents)
+	return t, err
+}
+
+func paymentError(c *gin.Context, signupID int, message string) {
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/signups/%d?payment_error=%s", signupID, url.QueryEscape(message)))
+}
+
+// SignupPaymentHandler shows a single signup with its payment and refunds
+func (h *Handlers) SignupPaymentHandler(c *gin.Context) {
+	signupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Signup not found")
+		return
+	}
+
+	var signup Signup
+	var workshop Workshop
+	var paymentMethod sql.NullString
+	err = h.db.QueryRow(`
+        SELECT s.id, s.workshop_id, s.first_name, s.last_name, s.email, s.phone, s.status,
+               s.price_cents, COALESCE(s.discount_code, ''), s.payment_status, s.amount_paid_cents,
+               s.payment_method, s.refund_due, s.created_at, w.title, w.date, w.currency
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.id = ?
+    `, signupID).Scan(&signup.ID, &signup.WorkshopID, &signup.FirstName, &signup.LastName,
+		&signup.Email, &signup.Phone, &signup.Status, &signup.PriceCents, &signup.DiscountCode,
+		&signup.PaymentStatus, &signup.AmountPaidCents, &paymentMethod, &signup.RefundDue, &signup.CreatedAt,
+		&workshop.Title, &workshop.Date, &workshop.Currency)
+
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Signup not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading signup %d: %v", signupID, err)
+		c.String(http.StatusInternalServerError, "Error loading signup: %v", err)
+		return
+	}
+	signup.PaymentMethod = paymentMethod.String
+	workshop.ID = signup.WorkshopID
+
+	rows, err := h.db.Query(`
+        SELECT id, amount_cents, COALESCE(note, ''), created_at
+        FROM refunds
+        WHERE signup_id = ?
+        ORDER BY created_at ASC
+    `, signupID)
+	if err != nil {
+		log.Printf("Error loading refunds: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading refunds: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var refunds []Refund
+	for rows.Next() {
+		r := Refund{SignupID: signupID}
+		if err := rows.Scan(&r.ID, &r.AmountCents, &r.Note, &r.CreatedAt); err != nil {
+			log.Printf("Error scanning refund row: %v", err)
+			continue
+		}
+		signup.RefundedCents += r.AmountCents
+		refunds = append(refunds, r)
+	}
+
+	c.HTML(http.StatusOK, "signup.html", gin.H{
+		"Signup":          signup,
+		"Workshop":        workshop,
+		"Refunds":         refunds,
+		"PaymentStatuses": []string{PaymentPending, PaymentPaid, PaymentRefunded, PaymentFailed},
+		"PaymentMethods":  paymentMethods,
+		"PaymentError":    c.Query("payment_error"),
+		"Saved":           c.Query("saved") == "true",
+	})
+}
+
+// RecordPaymentHandler sets the payment state of a signup, e.g. after a bank
+// transfer arrived or cash was collected at the door
+func (h *Handlers) RecordPaymentHandler(c *gin.Context) {
+	signupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Signup not found")
+		return
+	}
+
+	var form struct {
+		PaymentStatus string `form:"payment_status" binding:"required,oneof=pending paid refunded failed"`
+		Amount        string `form:"amount"`
+		PaymentMethod string `form:"payment_method"`
+	}
+
+	if err := c.ShouldBind(&form); err != nil {
+		paymentError(c, signupID, "Please choose a payment status")
+		return
+	}
+
+	if form.PaymentMethod != "" && !slices.Contains(paymentMethods, form.PaymentMethod) {
+		paymentError(c, signupID, "Unknown payment method")
+		return
+	}
+
+	amountCents, err := parsePriceCents(form.Amount)
+	if err != nil {
+		paymentError(c, signupID, "Invalid amount")
+		return
+	}
+
+	var priceCents, paidCents int
+	err = h.db.QueryRow("SELECT price_cents, amount_paid_cents FROM signups WHERE id = ?", signupID).
+		Scan(&priceCents, &paidCents)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Signup not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading payment for signup %d: %v", signupID, err)
+		paymentError(c, signupID, "Error saving payment")
+		return
+	}
+
+	// Paid with the amount left blank means the outstanding balance came in
+	if form.PaymentStatus == PaymentPaid {
+		if strings.TrimSpace(form.Amount) == "" {
+			amountCents = max(priceCents, paidCents)
+		}
+		if amountCents <= 0 && priceCents > 0 {
+			paymentError(c, signupID, "Please enter the amount received")
+			return
+		}
+	}
+
+	var method any
+	if form.PaymentMethod != "" {
+		method = form.PaymentMethod
+	}
+
+	_, err = h.db.Exec(`
+        UPDATE signups SET payment_status = ?, amount_paid_cents = ?, payment_method = ?,
+                           refund_due = refund_due AND ? != 'refunded'
+        WHERE id = ?
+    `, form.PaymentStatus, amountCents, method, form.PaymentStatus, signupID)
+
+	if err != nil {
+		log.Printf("Error recording payment for signup %d: %v", signupID, err)
+		paymentError(c, signupID, "Error saving payment")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/signups/%d?saved=true", signupID))
+}
+
+// RecordRefundHandler adds a (partial) refund. Once everything received has
+// been paid back the signup is marked refunded.
+func (h *Handlers) RecordRefundHandler(c *gin.Context) {
+	signupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Signup not found")
+		return
+	}
+
+	var form struct {
+		Amount string `form:"amount" binding:"required"`
+		Note   string `form:"note" binding:"max=500"`
+	}
+
+	if err := c.ShouldBind(&form); err != nil {
+		paymentError(c, signupID, "Please enter the refunded amount")
+		return
+	}
+
+	amountCents, err := parsePriceCents(form.Amount)
+	if err != nil || amountCents == 0 {
+		paymentError(c, signupID, "Invalid amount")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting refund transaction: %v", err)
+		paymentError(c, signupID, "Error saving refund")
+		return
+	}
+	defer tx.Rollback()
+
+	var paidCents, refundedCents int
+	err = tx.QueryRow(`
+        SELECT s.amount_paid_cents,
+               (SELECT COALESCE(SUM(amount_cents), 0) FROM refunds WHERE signup_id = s.id)
+        FROM signups s
+        WHERE s.id = ?
+    `, signupID).Scan(&paidCents, &refundedCents)
+	if err != nil {
+		log.Printf("Error loading payment for signup %d: %v", signupID, err)
+		paymentError(c, signupID, "Error saving refund")
+		return
+	}
+
+	if refundedCents+amountCents > paidCents {
+		paymentError(c, signupID, "Refunds can't exceed the amount paid")
+		return
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO refunds (signup_id, amount_cents, note) VALUES (?, ?, ?)
+    `, signupID, amountCents, strings.TrimSpace(form.Note))
+	if err != nil {
+		log.Printf("Error inserting refund: %v", err)
+		paymentError(c, signupID, "Error saving refund")
+		return
+	}
+
+	if refundedCents+amountCents == paidCents {
+		_, err = tx.Exec("UPDATE signups SET payment_status = 'refunded', refund_due = 0 WHERE id = ?", signupID)
+		if err != nil {
+			log.Printf("Error marking signup %d refunded: %v", signupID, err)
+			paymentError(c, signupID, "Error saving refund")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing refund: %v", err)
+		paymentError(c, signupID, "Error saving refund")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/signups/%d?saved=true", signupID))
+}
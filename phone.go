@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+)
+
+// PhoneCountry describes how phone numbers work in a country. The national
+// number is what follows the country code in E.164, without the trunk prefix
+// people dial at home (the 0 in Swiss 079 ...).
+type PhoneCountry struct {
+	Code        string // ISO 3166, also the picker's value
+	Flag        string
+	DialCode    string
+	TrunkPrefix string
+	MinDigits   int // of the national number
+	MaxDigits   int
+	Groups      []int // how to space national numbers of the usual length
+}
+
+// phoneCountries are offered in the phone picker, in this order
+var phoneCountries = []PhoneCountry{
+	{Code: "US", Flag: "🇺🇸", DialCode: "1", TrunkPrefix: "1", MinDigits: 10, MaxDigits: 10, Groups: []int{3, 3, 4}},
+	{Code: "GB", Flag: "🇬🇧", DialCode: "44", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 10, Groups: []int{4, 6}},
+	{Code: "CH", Flag: "🇨🇭", DialCode: "41", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 9, Groups: []int{2, 3, 2, 2}},
+	{Code: "DE", Flag: "🇩🇪", DialCode: "49", TrunkPrefix: "0", MinDigits: 6, MaxDigits: 11},
+	{Code: "FR", Flag: "🇫🇷", DialCode: "33", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 9, Groups: []int{1, 2, 2, 2, 2}},
+	{Code: "IT", Flag: "🇮🇹", DialCode: "39", MinDigits: 6, MaxDigits: 11, Groups: []int{3, 3, 4}},
+	{Code: "ES", Flag: "🇪🇸", DialCode: "34", MinDigits: 9, MaxDigits: 9, Groups: []int{3, 3, 3}},
+	{Code: "NL", Flag: "🇳🇱", DialCode: "31", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 9, Groups: []int{1, 8}},
+	{Code: "BE", Flag: "🇧🇪", DialCode: "32", TrunkPrefix: "0", MinDigits: 8, MaxDigits: 9, Groups: []int{3, 2, 2, 2}},
+	{Code: "AT", Flag: "🇦🇹", DialCode: "43", TrunkPrefix: "0", MinDigits: 4, MaxDigits: 13},
+	{Code: "PT", Flag: "🇵🇹", DialCode: "351", MinDigits: 9, MaxDigits: 9, Groups: []int{3, 3, 3}},
+	{Code: "SE", Flag: "🇸🇪", DialCode: "46", TrunkPrefix: "0", MinDigits: 7, MaxDigits: 10},
+	{Code: "NO", Flag: "🇳🇴", DialCode: "47", MinDigits: 8, MaxDigits: 8, Groups: []int{3, 2, 3}},
+	{Code: "DK", Flag: "🇩🇰", DialCode: "45", MinDigits: 8, MaxDigits: 8, Groups: []int{2, 2, 2, 2}},
+	{Code: "FI", Flag: "🇫🇮", DialCode: "358", TrunkPrefix: "0", MinDigits: 5, MaxDigits: 12},
+	{Code: "IN", Flag: "🇮🇳", DialCode: "91", TrunkPrefix: "0", MinDigits: 10, MaxDigits: 10, Groups: []int{5, 5}},
+	{Code: "CN", Flag: "🇨🇳", DialCode: "86", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 11},
+	{Code: "JP", Flag: "🇯🇵", DialCode: "81", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 10},
+	{Code: "AU", Flag: "🇦🇺", DialCode: "61", TrunkPrefix: "0", MinDigits: 9, MaxDigits: 9, Groups: []int{3, 3, 3}},
+	{Code: "NZ", Flag: "🇳🇿", DialCode: "64", TrunkPrefix: "0", MinDigits: 8, MaxDigits: 10},
+	{Code: "MX", Flag: "🇲🇽", DialCode: "52", MinDigits: 10, MaxDigits: 10, Groups: []int{2, 4, 4}},
+	{Code: "BR", Flag: "🇧🇷", DialCode: "55", TrunkPrefix: "0", MinDigits: 10, MaxDigits: 11},
+}
+
+// defaultPhoneCountry is preselected, most participants are Swiss
+const defaultPhoneCountry = "CH"
+
+var errInvalidPhone = errors.New("invalid phone number")
+
+// lookupPhoneCountry accepts the picker's "CH" as well as "+41" or "41",
+// which older forms and CSV files use
+func lookupPhoneCountry(value string) (PhoneCountry, bool) {
+	value = strings.TrimSpace(value)
+	dial := strings.TrimPrefix(value, "+")
+	for _, country := range phoneCountries {
+		if strings.EqualFold(country.Code, value) || country.DialCode == dial {
+			return country, true
+		}
+	}
+	return PhoneCountry{}, false
+}
+
+// phoneCountryByNumber finds the country of international digits, the
+// longest matching dial code wins
+func phoneCountryByNumber(digits string) (PhoneCountry, bool) {
+	var best PhoneCountry
+	for _, country := range phoneCountries {
+		if strings.HasPrefix(digits, country.DialCode) && len(country.DialCode) > len(best.DialCode) {
+			best = country
+		}
+	}
+	return best, best.DialCode != ""
+}
+
+// normalizePhone turns what someone typed into E.164, e.g. "+41791234567".
+// Numbers starting with + or 00 carry their own country, others are national
+// numbers of country, the picker's value. An empty number stays empty.
+func normalizePhone(country, input string) (string, error) {
+	cleaned := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "", "/", "").Replace(strings.TrimSpace(input))
+	if cleaned == "" {
+		return "", nil
+	}
+
+	var c PhoneCountry
+	var national string
+	switch {
+	case strings.HasPrefix(cleaned, "+") || strings.HasPrefix(cleaned, "00"):
+		digits := strings.TrimPrefix(strings.TrimPrefix(cleaned, "+"), "00")
+		if !isDigits(digits) {
+			return "", errInvalidPhone
+		}
+		var ok bool
+		if c, ok = phoneCountryByNumber(digits); !ok {
+			// Countries we don't know only get E.164's overall length check
+			if len(digits) < 8 || len(digits) > 15 {
+				return "", errInvalidPhone
+			}
+			return "+" + digits, nil
+		}
+		national = digits[len(c.DialCode):]
+	default:
+		var ok bool
+		if c, ok = lookupPhoneCountry(country); !ok {
+			return "", errInvalidPhone
+		}
+		national = cleaned
+	}
+
+	if !isDigits(national) {
+		return "", errInvalidPhone
+	}
+	// People often keep the trunk prefix, e.g. +41 079 ...
+	if c.TrunkPrefix != "" && len(national) > c.MinDigits {
+		national = strings.TrimPrefix(national, c.TrunkPrefix)
+	}
+	if len(national) < c.MinDigits || len(national) > c.MaxDigits {
+		return "", errInvalidPhone
+	}
+	return "+" + c.DialCode + national, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatPhone spaces an E.164 number for reading, e.g. "+41 79 123 45 67".
+// Anything it can't make sense of is shown as stored.
+func formatPhone(phone string) string {
+	digits, ok := strings.CutPrefix(phone, "+")
+	if !ok || !isDigits(digits) {
+		return phone
+	}
+	c, ok := phoneCountryByNumber(digits)
+	if !ok {
+		return phone
+	}
+	national := digits[len(c.DialCode):]
+
+	total := 0
+	for _, n := range c.Groups {
+		total += n
+	}
+	if total != len(national) {
+		return "+" + c.DialCode + " " + national
+	}
+
+	parts := []string{"+" + c.DialCode}
+	for _, n := range c.Groups {
+		parts = append(parts, national[:n])
+		national = national[n:]
+	}
+	return strings.Join(parts, " ")
+}
+
+// normalizeStoredPhones converts numbers saved before they were kept in
+// E.164, like "+41 079 123 45 67". Numbers that don't parse are left alone.
+func normalizeStoredPhones(db *sql.DB) {
+	for _, table := range []string{"signups", "participants", "course_enrollments"} {
+		rows, err := db.Query(`
+            SELECT id, phone FROM ` + table + `
+            WHERE phone != '' AND (phone NOT GLOB '+[0-9]*' OR phone GLOB '*[^+0-9]*')
+        `)
+		if err != nil {
+			log.Fatal(err)
+		}
+		updates := map[int]string{}
+		for rows.Next() {
+			var id int
+			var phone string
+			if err := rows.Scan(&id, &phone); err != nil {
+				log.Fatal(err)
+			}
+			if normalized, err := normalizePhone(defaultPhoneCountry, phone); err == nil {
+				updates[id] = normalized
+			}
+		}
+		rows.Close()
+
+		for id, phone := range updates {
+			if _, err := db.Exec("UPDATE "+table+" SET phone = ? WHERE id = ?", phone, id); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if len(updates) > 0 {
+			log.Printf("✓ Normalized %d phone numbers in %s", len(updates), table)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// Participants aren't told why a code can't be used
+var errInvalidDiscountCode = errors.New("discount code not valid for this workshop")
+
+type DiscountCode struct {
+	ID         int
+	Code       string
+	Kind       string
+	Amount     int // percent, or cents for fixed discounts
+	MaxUses    sql.NullInt64
+	ValidFrom  sql.NullString
+	ValidUntil sql.NullString
+	WorkshopID sql.NullInt64
+	Uses       int
+}
+
+// Describe returns the discount in lang, e.g. "20% off" or "CHF 10.00 off".
+// Fixed discounts are in the currency of the workshop they're used for.
+func (d DiscountCode) Describe(currency, lang string) string {
+	if d.Kind == DiscountPercent {
+		return translate(lang, "signup.discount_off", fmt.Sprintf("%d%%", d.Amount))
+	}
+	return translate(lang, "signup.discount_off", formatMoney(d.Amount, currency))
+}
+
+// Apply returns the price after the discount, never below zero
+func (d DiscountCode) Apply(priceCents int) int {
+	var discounted int
+	if d.Kind == DiscountPercent {
+		discounted = priceCents - (priceCents*d.Amount+50)/100
+	} else {
+		discounted = priceCents - d.Amount
+	}
+	return max(discounted, 0)
+}
+
+// Validity returns the window in which the code can be used, for the admin panel
+func (d DiscountCode) Validity() string {
+	from := formatAdminDate(d.ValidFrom, false)
+	until := formatAdminDate(d.ValidUntil, true)
+	switch {
+	case from == "" && until == "":
+		return "Always"
+	case from == "":
+		return "Until " + until
+	case until == "":
+		return "From " + from
+	}
+	return from + " – " + until
+}
+
+// PriceTier is an early-bird price that applies to signups before EndsAt
+type PriceTier struct {
+	ID         int
+	WorkshopID int
+	PriceCents int
+	Currency   string
+	EndsAt     string
+}
+
+func (t PriceTier) FormattedPrice() string {
+	return formatMoney(t.PriceCents, t.Currency)
+}
+
+// EndsAtDisplay returns the last day of the tier, EndsAt is the midnight after it
+func (t PriceTier) EndsAtDisplay() string {
+	endsAt, err := parseDBTime(t.EndsAt)
+	if err != nil {
+		return t.EndsAt
+	}
+	return endsAt.Add(-time.Second).Local().Format("January 2, 2006")
+}
+
+// EndsAtIn is EndsAtDisplay in the visitor's language
+func (t PriceTier) EndsAtIn(lang string) string {
+	endsAt, err := parseDBTime(t.EndsAt)
+	if err != nil {
+		return t.EndsAt
+	}
+	return formatLocalDate(endsAt.Add(-time.Second).Local(), lang, "date.day_layout")
+}
+
+// currentPrice returns the price a signup pays right now before discounts,
+// along with the early-bird tier it came from, if any.
+func currentPrice(q queryRower, workshop Workshop, now time.Time) (int, *PriceTier, error) {
+	tier := PriceTier{WorkshopID: workshop.ID, Currency: workshop.Currency}
+	err := q.QueryRow(`
+        SELECT id, price_cents, ends_at
+        FROM price_tiers
+        WHERE workshop_id = ? AND ends_at > ?
+        ORDER BY ends_at ASC
+        LIMIT 1
+    `, workshop.ID, now.UTC().Format(sqliteTimeLayout)).Scan(&tier.ID, &tier.PriceCents, &tier.EndsAt)
+
+	if err == sql.ErrNoRows {
+		return workshop.PriceCents, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return tier.PriceCents, &tier, nil
+}
+
+// lookupDiscountCode finds a code that is usable for the workshop right now.
+// Uses are counted from signups holding a seat, so expired holds give the use back.
+func lookupDiscountCode(q queryRower, code string, workshopID int, now time.Time) (*DiscountCode, error) {
+	var d DiscountCode
+	err := q.QueryRow(`
+        SELECT id, code, kind, amount, max_uses, valid_from, valid_until, workshop_id
+        FROM discount_codes
+        WHERE code = ? COLLATE NOCASE
+    `, strings.TrimSpace(code)).Scan(&d.ID, &d.Code, &d.Kind, &d.Amount, &d.MaxUses,
+		&d.ValidFrom, &d.ValidUntil, &d.WorkshopID)
+
+	if err == sql.ErrNoRows {
+		return nil, errInvalidDiscountCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nowUTC := now.UTC().Format(sqliteTimeLayout)
+	if d.WorkshopID.Valid && int(d.WorkshopID.Int64) != workshopID {
+		return nil, errInvalidDiscountCode
+	}
+	if d.ValidFrom.Valid && nowUTC < d.ValidFrom.String {
+		return nil, errInvalidDiscountCode
+	}
+	if d.ValidUntil.Valid && nowUTC >= d.ValidUntil.String {
+		return nil, errInvalidDiscountCode
+	}
+
+	if d.MaxUses.Valid {
+		err = q.QueryRow(`
+            SELECT COUNT(*) FROM signups
+            WHERE discount_code = ? AND `+seatTakenCondition,
+			d.Code).Scan(&d.Uses)
+		if err != nil {
+			return nil, err
+		}
+		if int64(d.Uses) >= d.MaxUses.Int64 {
+			return nil, errInvalidDiscountCode
+		}
+	}
+
+	return &d, nil
+}
+
+// parseAdminDate turns a date input into the UTC timestamp at the start of that
+// day, or of the following day when endOfDay is set. Empty means no limit.
+func parseAdminDate(value string, endOfDay bool) (any, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day.UTC().Format(sqliteTimeLayout), nil
+}
+
+// formatAdminDate reverses parseAdminDate for display
+func formatAdminDate(value sql.NullString, endOfDay bool) string {
+	if !value.Valid {
+		return ""
+	}
+
+	t, err := parseDBTime(value.String)
+	if err != nil {
+		return value.String
+	}
+	if endOfDay {
+		t = t.Add(-time.Second)
+	}
+	return t.Local().Format("Jan 2, 2006")
+}
+
+// adminWorkshopURL is the admin panel showing a workshop, 0 shows the
+// current one
+func adminWorkshopURL(workshopID int, query url.Values) string {
+	if workshopID > 0 {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("workshop", strconv.Itoa(workshopID))
+	}
+	if len(query) == 0 {
+		return "/admin"
+	}
+	return "/admin?" + query.Encode()
+}
+
+// pricingError goes back to the workshop the admin was looking at
+func pricingError(c *gin.Context, workshopID int, message string) {
+	c.Redirect(http.StatusSeeOther, adminWorkshopURL(workshopID, url.Values{"pricing_error": {message}}))
+}
+
+// returnWorkshopID is the workshop the admin panel showed when a pricing form
+// was sent
+func returnWorkshopID(c *gin.Context) int {
+	id, _ := strconv.Atoi(c.PostForm("return_workshop"))
+	return id
+}
+
+func (h *Handlers) CreateDiscountCodeHandler(c *gin.Context) {
+	var form struct {
+		Code       string `form:"code" binding:"required,alphanum,max=32"`
+		Kind       string `form:"kind" binding:"required,oneof=percent fixed"`
+		Amount     string `form:"amount" binding:"required"`
+		MaxUses    int    `form:"max_uses" binding:"omitempty,min=1"`
+		ValidFrom  string `form:"valid_from"`
+		ValidUntil string `form:"valid_until"`
+		WorkshopID int    `form:"workshop_id"`
+	}
+
+	if err := c.ShouldBind(&form); err != nil {
+		pricingError(c, returnWorkshopID(c), "Please enter a code (letters and digits only), a type and an amount")
+		return
+	}
+
+	var amount int
+	if form.Kind == DiscountPercent {
+		if _, err := fmt.Sscanf(form.Amount, "%d", &amount); err != nil || amount < 1 || amount > 100 {
+			pricingError(c, returnWorkshopID(c), "Percentage must be between 1 and 100")
+			return
+		}
+	} else {
+		cents, err := parsePriceCents(form.Amount)
+		if err != nil || cents == 0 {
+			pricingError(c, returnWorkshopID(c), "Invalid discount amount")
+			return
+		}
+		amount = cents
+	}
+
+	validFrom, err := parseAdminDate(form.ValidFrom, false)
+	if err != nil {
+		pricingError(c, returnWorkshopID(c), "Invalid start date")
+		return
+	}
+	validUntil, err := parseAdminDate(form.ValidUntil, true)
+	if err != nil {
+		pricingError(c, returnWorkshopID(c), "Invalid end date")
+		return
+	}
+
+	var maxUses, workshopID any
+	if form.MaxUses > 0 {
+		maxUses = form.MaxUses
+	}
+	if form.WorkshopID > 0 {
+		workshopID = form.WorkshopID
+	}
+
+	_, err = h.db.Exec(`
+        INSERT INTO discount_codes (code, kind, amount, max_uses, valid_from, valid_until, workshop_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, strings.ToUpper(form.Code), form.Kind, amount, maxUses, validFrom, validUntil, workshopID)
+
+	if err != nil {
+		log.Printf("Error creating discount code: %v", err)
+		pricingError(c, returnWorkshopID(c), "Could not create code, it may already exist")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, adminWorkshopURL(returnWorkshopID(c), nil))
+}
+
+func (h *Handlers) DeleteDiscountCodeHandler(c *gin.Context) {
+	_, err := h.db.Exec("DELETE FROM discount_codes WHERE id = ?", c.PostForm("id"))
+	if err != nil {
+		log.Printf("Error deleting discount code: %v", err)
+		pricingError(c, returnWorkshopID(c), "Could not delete code")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, adminWorkshopURL(returnWorkshopID(c), nil))
+}
+
+func (h *Handlers) CreatePriceTierHandler(c *gin.Context) {
+	var form struct {
+		WorkshopID int    `form:"workshop_id" binding:"required"`
+		Price      string `form:"price" binding:"required"`
+		EndsOn     string `form:"ends_on" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&form); err != nil {
+		pricingError(c, form.WorkshopID, "Please enter a price and the last day of the early-bird price")
+		return
+	}
+
+	priceCents, err := parsePriceCents(form.Price)
+	if err != nil {
+		pricingError(c, form.WorkshopID, "Invalid price")
+		return
+	}
+
+	endsAt, err := parseAdminDate(form.EndsOn, true)
+	if err != nil {
+		pricingError(c, form.WorkshopID, "Invalid date")
+		return
+	}
+
+	_, err = h.db.Exec(`
+        INSERT INTO price_tiers (workshop_id, price_cents, ends_at)
+        VALUES (?, ?, ?)
+    `, form.WorkshopID, priceCents, endsAt)
+
+	if err != nil {
+		log.Printf("Error creating price tier: %v", err)
+		pricingError(c, form.WorkshopID, "Could not add early-bird price")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, adminWorkshopURL(form.WorkshopID, nil))
+}
+
+func (h *Handlers) DeletePriceTierHandler(c *gin.Context) {
+	var workshopID int
+	err := h.db.QueryRow("DELETE FROM price_tiers WHERE id = ? RETURNING workshop_id", c.PostForm("id")).Scan(&workshopID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error deleting price tier: %v", err)
+		pricingError(c, returnWorkshopID(c), "Could not delete early-bird price")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, adminWorkshopURL(workshopID, nil))
+}
+
+// loadPricing returns the early-bird tiers of a workshop and all discount codes
+func (h *Handlers) loadPricing(workshop Workshop) ([]PriceTier, []DiscountCode, error) {
+	rows, err := h.db.Query(`
+        SELECT id, price_cents, ends_at
+        FROM price_tiers
+        WHERE workshop_id = ?
+        ORDER BY ends_at ASC
+    `, workshop.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var tiers []PriceTier
+	for rows.Next() {
+		t := PriceTier{WorkshopID: workshop.ID, Currency: workshop.Currency}
+		if err := rows.Scan(&t.ID, &t.PriceCents, &t.EndsAt); err != nil {
+			return nil, nil, err
+		}
+		tiers = append(tiers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	codeRows, err := h.db.Query(`
+        SELECT d.id, d.code, d.kind, d.amount, d.max_uses, d.valid_from, d.valid_until, d.workshop_id,
+               (SELECT COUNT(*) FROM signups WHERE discount_code = d.code AND ` + seatTakenCondition + `)
+        FROM discount_codes d
+        ORDER BY d.code
+    `)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer codeRows.Close()
+
+	var codes []DiscountCode
+	for codeRows.Next() {
+		var d DiscountCode
+		err := codeRows.Scan(&d.ID, &d.Code, &d.Kind, &d.Amount, &d.MaxUses,
+			&d.ValidFrom, &d.ValidUntil, &d.WorkshopID, &d.Uses)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, d)
+	}
+
+	return tiers, codes, codeRows.Err()
+}
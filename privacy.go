@@ -0,0 +1,597 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const privacyPurpose = "privacy"
+
+// privacyLinkValidity is how long a self-service link works. Anyone holding
+// it can download or erase the data, so it shouldn't live forever.
+const privacyLinkValidity = 24 * time.Hour
+
+// anonymizedName replaces the first name of erased signups so the rosters
+// and exports still show the seat was taken
+const anonymizedName = "Anonymized"
+
+// PersonalData is everything we store about one email address
+type PersonalData struct {
+	Email             string               `json:"email"`
+	ExportedAt        string               `json:"exported_at"`
+	Profile           *PersonalProfile     `json:"profile"`
+	Signups           []PersonalSignup     `json:"signups"`
+	CourseEnrollments []PersonalEnrollment `json:"course_enrollments"`
+	Newsletter        *NewsletterStatus    `json:"newsletter"`
+	Emails            []PersonalEmail      `json:"emails"`
+}
+
+// PersonalProfile is the participant record, i.e. the latest contact details
+type PersonalProfile struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Phone     string `json:"phone"`
+	CreatedAt string `json:"created_at"`
+}
+
+// PersonalSignup is a signup together with the workshop it was for
+type PersonalSignup struct {
+	Signup
+	Workshop         string `json:"workshop"`
+	WorkshopDate     string `json:"workshop_date"`
+	WorkshopLocation string `json:"workshop_location"`
+}
+
+// PersonalEnrollment is a registration for a whole course
+type PersonalEnrollment struct {
+	ID        int    `json:"id"`
+	Course    string `json:"course"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Phone     string `json:"phone"`
+	CreatedAt string `json:"created_at"`
+}
+
+// PersonalEmail is a message we sent or are about to send
+type PersonalEmail struct {
+	Subject   string `json:"subject"`
+	Kind      string `json:"kind"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+	SentAt    string `json:"sent_at"`
+}
+
+// NewsletterStatus is the newsletter subscription of one address
+type NewsletterStatus struct {
+	Status         string `json:"status"`
+	RequestedAt    string `json:"requested_at"`
+	ConfirmedAt    string `json:"confirmed_at"`
+	UnsubscribedAt string `json:"unsubscribed_at"`
+}
+
+// IsEmpty reports whether we hold nothing at all about the address
+func (d PersonalData) IsEmpty() bool {
+	return d.Profile == nil && len(d.Signups) == 0 && len(d.CourseEnrollments) == 0 &&
+		d.Newsletter == nil && len(d.Emails) == 0
+}
+
+// collectPersonalData gathers the data for an export. Signups are matched by
+// participant as well as by address, so merged duplicates are included.
+func (h *Handlers) collectPersonalData(email string) (PersonalData, error) {
+	email = normalizeEmail(email)
+	data := PersonalData{
+		Email:             email,
+		ExportedAt:        time.Now().Format(time.RFC3339),
+		Signups:           []PersonalSignup{},
+		CourseEnrollments: []PersonalEnrollment{},
+		Emails:            []PersonalEmail{},
+	}
+
+	var p PersonalProfile
+	err := h.db.QueryRow(`
+        SELECT first_name, last_name, COALESCE(phone, ''), created_at
+        FROM participants WHERE email = ?
+    `, email).Scan(&p.FirstName, &p.LastName, &p.Phone, &p.CreatedAt)
+	if err == nil {
+		data.Profile = &p
+	} else if err != sql.ErrNoRows {
+		return data, err
+	}
+
+	rows, err := h.db.Query(`
+        SELECT s.id, s.workshop_id, s.first_name, s.last_name, s.email, COALESCE(s.phone, ''),
+               s.status, s.seats, COALESCE(s.language, ''), s.price_cents, COALESCE(s.discount_code, ''), s.payment_status,
+               s.amount_paid_cents, COALESCE(s.payment_method, ''),
+               (SELECT COALESCE(SUM(amount_cents), 0) FROM refunds WHERE signup_id = s.id),
+               COALESCE(s.attended_at, ''), s.created_at,
+               COALESCE(w.title, ''), COALESCE(w.date, ''), COALESCE(w.location, '')
+        FROM signups s
+        LEFT JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.anonymized_at IS NULL
+          AND (LOWER(TRIM(s.email)) = ? OR s.participant_id = (SELECT id FROM participants WHERE email = ?))
+        ORDER BY s.created_at
+    `, email, email)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s PersonalSignup
+		err := rows.Scan(&s.ID, &s.WorkshopID, &s.FirstName, &s.LastName, &s.Email, &s.Phone,
+			&s.Status, &s.Seats, &s.Language, &s.PriceCents, &s.DiscountCode, &s.PaymentStatus,
+			&s.AmountPaidCents, &s.PaymentMethod, &s.RefundedCents, &s.AttendedAt, &s.CreatedAt,
+			&s.Workshop, &s.WorkshopDate, &s.WorkshopLocation)
+		if err != nil {
+			return data, err
+		}
+		data.Signups = append(data.Signups, s)
+	}
+	rows.Close()
+
+	mine := `s.anonymized_at IS NULL
+          AND (LOWER(TRIM(s.email)) = ? OR s.participant_id = (SELECT id FROM participants WHERE email = ?))`
+	answers, err := h.loadAnswers(mine, email, email)
+	if err != nil {
+		return data, err
+	}
+	consents, err := h.loadConsents(mine, email, email)
+	if err != nil {
+		return data, err
+	}
+	guests, err := h.loadGuests(mine, email, email)
+	if err != nil {
+		return data, err
+	}
+	for i := range data.Signups {
+		data.Signups[i].Answers = answers[data.Signups[i].ID]
+		data.Signups[i].Consents = consents[data.Signups[i].ID]
+		data.Signups[i].Guests = guests[data.Signups[i].ID]
+	}
+
+	rows, err = h.db.Query(`
+        SELECT e.id, c.title, e.first_name, e.last_name, COALESCE(e.phone, ''), e.created_at
+        FROM course_enrollments e
+        JOIN courses c ON c.id = e.course_id
+        WHERE LOWER(TRIM(e.email)) = ?
+        ORDER BY e.created_at
+    `, email)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e PersonalEnrollment
+		if err := rows.Scan(&e.ID, &e.Course, &e.FirstName, &e.LastName, &e.Phone, &e.CreatedAt); err != nil {
+			return data, err
+		}
+		data.CourseEnrollments = append(data.CourseEnrollments, e)
+	}
+	rows.Close()
+
+	var n NewsletterStatus
+	err = h.db.QueryRow(`
+        SELECT status, COALESCE(requested_at, ''), COALESCE(confirmed_at, ''), COALESCE(unsubscribed_at, '')
+        FROM newsletter_subscriptions WHERE email = ?
+    `, email).Scan(&n.Status, &n.RequestedAt, &n.ConfirmedAt, &n.UnsubscribedAt)
+	if err == nil {
+		data.Newsletter = &n
+	} else if err != sql.ErrNoRows {
+		return data, err
+	}
+
+	rows, err = h.db.Query(`
+        SELECT subject, kind, status, created_at, COALESCE(sent_at, '')
+        FROM email_outbox
+        WHERE LOWER(to_email) = ?
+        ORDER BY id
+    `, email)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m PersonalEmail
+		if err := rows.Scan(&m.Subject, &m.Kind, &m.Status, &m.CreatedAt, &m.SentAt); err != nil {
+			return data, err
+		}
+		data.Emails = append(data.Emails, m)
+	}
+
+	return data, rows.Err()
+}
+
+// anonymizeSignups blanks out the personal details of the signups matching
+// condition. Status, prices, payments and attendance stay, so seat counts,
+// revenue and attendance statistics don't change. Guest names and answers to
+// registration questions are deleted, answers often hold health details.
+// Emails still waiting in the outbox are dropped, sent ones keep only their
+// delivery status.
+func anonymizeSignups(tx *sql.Tx, condition string, args ...any) (int64, error) {
+	selected := "SELECT id FROM signups WHERE anonymized_at IS NULL AND (" + condition + ")"
+
+	_, err := tx.Exec(`
+        DELETE FROM signup_answers WHERE signup_id IN (`+selected+`)
+    `, args...)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+        DELETE FROM signup_guests WHERE signup_id IN (`+selected+`)
+    `, args...)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+        DELETE FROM email_outbox WHERE status = 'queued' AND signup_id IN (`+selected+`)
+    `, args...)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+        UPDATE email_outbox
+        SET to_email = '', subject = '', text_body = '', html_body = NULL, unsubscribe_url = NULL
+        WHERE signup_id IN (`+selected+`)
+    `, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+        UPDATE signups
+        SET first_name = ?, last_name = '', email = '', phone = '',
+            participant_id = NULL, anonymized_at = CURRENT_TIMESTAMP
+        WHERE id IN (`+selected+`)
+    `, append([]any{anonymizedName}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	count, _ := result.RowsAffected()
+
+	// Course registrations go once none of their sessions have details left
+	_, err = tx.Exec(`
+        UPDATE course_enrollments SET first_name = ?, last_name = '', email = '', phone = ''
+        WHERE email != ''
+          AND EXISTS (SELECT 1 FROM signups WHERE course_enrollment_id = course_enrollments.id)
+          AND NOT EXISTS (SELECT 1 FROM signups
+                          WHERE course_enrollment_id = course_enrollments.id AND anonymized_at IS NULL)
+    `, anonymizedName)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM participants
+        WHERE NOT EXISTS (SELECT 1 FROM signups WHERE participant_id = participants.id)
+    `)
+	return count, err
+}
+
+// erasePersonalData removes everything about an email address: signups are
+// anonymized, the newsletter subscription and participant are deleted
+func (h *Handlers) erasePersonalData(email string) (int64, error) {
+	email = normalizeEmail(email)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count, err := anonymizeSignups(tx,
+		"LOWER(TRIM(email)) = ? OR participant_id = (SELECT id FROM participants WHERE email = ?)",
+		email, email)
+	if err != nil {
+		return 0, err
+	}
+
+	statements := []string{
+		"UPDATE course_enrollments SET first_name = '" + anonymizedName + "', last_name = '', email = '', phone = '' WHERE LOWER(TRIM(email)) = ?",
+		"DELETE FROM participants WHERE email = ?",
+		"DELETE FROM newsletter_subscriptions WHERE email = ?",
+		"DELETE FROM blocked_signups WHERE LOWER(TRIM(email)) = ?",
+		"DELETE FROM email_outbox WHERE status = 'queued' AND LOWER(to_email) = ?",
+		"UPDATE email_outbox SET to_email = '', subject = '', text_body = '', html_body = NULL, unsubscribe_url = NULL WHERE LOWER(to_email) = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, email); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, tx.Commit()
+}
+
+// retentionMonthsFromEnv is how long after a workshop we keep participant
+// details, set with RETENTION_MONTHS. Zero keeps them until erased by hand.
+func retentionMonthsFromEnv() int {
+	months, err := strconv.Atoi(os.Getenv("RETENTION_MONTHS"))
+	if err != nil || months < 0 {
+		return 0
+	}
+	return months
+}
+
+// startRetentionSweeper anonymizes signups of workshops older than the
+// retention period, once at startup and then daily
+func startRetentionSweeper(db *sql.DB) {
+	months := retentionMonthsFromEnv()
+	if months == 0 {
+		return
+	}
+	log.Printf("✓ Participant details are anonymized %d months after the workshop", months)
+
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			applyRetention(db, months)
+			<-ticker.C
+		}
+	}()
+}
+
+func applyRetention(db *sql.DB, months int) (int64, error) {
+	cutoff := time.Now().AddDate(0, -months, 0).Format(startsAtLayout)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error applying retention: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count, err := anonymizeSignups(tx,
+		"workshop_id IN (SELECT id FROM workshops WHERE starts_at < ?)", cutoff)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error applying retention: %v", err)
+		return 0, err
+	}
+
+	if count > 0 {
+		log.Printf("✓ Anonymized %d signup(s) of workshops before %s", count, cutoff)
+	}
+	return count, nil
+}
+
+func writePersonalDataJSON(c *gin.Context, data PersonalData) {
+	body, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding personal data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting data"})
+		return
+	}
+
+	filename := "personal-data-" + slugify(data.Email) + ".json"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// AdminPrivacyHandler looks up what we store about an email address
+func (h *Handlers) AdminPrivacyHandler(c *gin.Context) {
+	email := normalizeEmail(c.Query("email"))
+	page := gin.H{
+		"Email":           email,
+		"Erased":          c.Query("erased"),
+		"Anonymized":      c.Query("anonymized"),
+		"RetentionMonths": retentionMonthsFromEnv(),
+	}
+
+	if email != "" {
+		data, err := h.collectPersonalData(email)
+		if err != nil {
+			log.Printf("Error loading personal data: %v", err)
+			c.String(http.StatusInternalServerError, "Error loading data: %v", err)
+			return
+		}
+		page["Data"] = data
+	}
+
+	c.HTML(http.StatusOK, "admin_privacy.html", page)
+}
+
+// AdminPrivacyExportHandler downloads the data about an address as JSON
+func (h *Handlers) AdminPrivacyExportHandler(c *gin.Context) {
+	data, err := h.collectPersonalData(c.Query("email"))
+	if err != nil {
+		log.Printf("Error loading personal data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting data"})
+		return
+	}
+	writePersonalDataJSON(c, data)
+}
+
+// AdminPrivacyEraseHandler erases an address on request, e.g. by email
+func (h *Handlers) AdminPrivacyEraseHandler(c *gin.Context) {
+	email := normalizeEmail(c.PostForm("email"))
+	if email == "" {
+		c.Redirect(http.StatusSeeOther, "/admin/privacy")
+		return
+	}
+
+	count, err := h.erasePersonalData(email)
+	if err != nil {
+		log.Printf("Error erasing personal data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing data"})
+		return
+	}
+
+	log.Printf("✓ Erased personal data on admin request (%d signups)", count)
+	c.Redirect(http.StatusSeeOther, "/admin/privacy?erased="+strconv.FormatInt(count, 10))
+}
+
+// RunRetentionHandler applies the retention period right away
+func (h *Handlers) RunRetentionHandler(c *gin.Context) {
+	months := retentionMonthsFromEnv()
+	if months == 0 {
+		c.Redirect(http.StatusSeeOther, "/admin/privacy")
+		return
+	}
+
+	count, err := applyRetention(h.db, months)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying retention"})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/privacy?anonymized="+strconv.FormatInt(count, 10))
+}
+
+// privacyLink is the self-service link we email to people asking for their
+// data. The expiry is part of the signed payload.
+func (h *Handlers) privacyLink(c *gin.Context, email string) string {
+	expires := time.Now().Add(privacyLinkValidity).Unix()
+	token := signToken(h.signingKey, privacyPurpose, fmt.Sprintf("%s|%d", normalizeEmail(email), expires))
+	return fmt.Sprintf("%s/privacy/manage?token=%s", baseURL(c), url.QueryEscape(token))
+}
+
+func (h *Handlers) verifyPrivacyToken(token string) (string, bool) {
+	payload, ok := verifyToken(h.signingKey, privacyPurpose, token)
+	if !ok {
+		return "", false
+	}
+	i := strings.LastIndex(payload, "|")
+	if i < 0 {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(payload[i+1:], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+	return payload[:i], true
+}
+
+func (h *Handlers) privacyTokenOrError(c *gin.Context, token string) (string, bool) {
+	email, ok := h.verifyPrivacyToken(token)
+	if !ok {
+		c.HTML(http.StatusBadRequest, "privacy.html", gin.H{
+			"Error": "This link is invalid or has expired. Please request a new one below.",
+		})
+	}
+	return email, ok
+}
+
+// PrivacyHandler is where people request a link to their data
+func (h *Handlers) PrivacyHandler(c *gin.Context) {
+	c.HTML(http.StatusOK, "privacy.html", gin.H{})
+}
+
+// PrivacyRequestHandler emails the self-service link. The answer is the same
+// whether or not we know the address, so it can't be used to look people up.
+func (h *Handlers) PrivacyRequestHandler(c *gin.Context) {
+	email := normalizeEmail(c.PostForm("email"))
+	if !strings.Contains(email, "@") {
+		c.HTML(http.StatusBadRequest, "privacy.html", gin.H{"Error": "Please enter a valid email address"})
+		return
+	}
+
+	data, err := h.collectPersonalData(email)
+	if err != nil {
+		log.Printf("Error loading personal data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error requesting data"})
+		return
+	}
+	if !data.IsEmpty() {
+		go sendPrivacyLinkEmail(email, h.privacyLink(c, email))
+	}
+
+	c.HTML(http.StatusOK, "privacy.html", gin.H{
+		"Message": "If we have any data about " + email + ", we've emailed you a link to view, download or erase it. The link works for 24 hours.",
+	})
+}
+
+// PrivacyManageHandler is the page the self-service link opens
+func (h *Handlers) PrivacyManageHandler(c *gin.Context) {
+	token := c.Query("token")
+	email, ok := h.privacyTokenOrError(c, token)
+	if !ok {
+		return
+	}
+
+	data, err := h.collectPersonalData(email)
+	if err != nil {
+		log.Printf("Error loading personal data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading data"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "privacy.html", gin.H{
+		"Manage": true,
+		"Data":   data,
+		"Token":  token,
+	})
+}
+
+// PrivacyExportHandler downloads the data behind a self-service link
+func (h *Handlers) PrivacyExportHandler(c *gin.Context) {
+	email, ok := h.privacyTokenOrError(c, c.Query("token"))
+	if !ok {
+		return
+	}
+
+	data, err := h.collectPersonalData(email)
+	if err != nil {
+		log.Printf("Error loading personal data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting data"})
+		return
+	}
+	writePersonalDataJSON(c, data)
+}
+
+// PrivacyEraseHandler erases the data behind a self-service link
+func (h *Handlers) PrivacyEraseHandler(c *gin.Context) {
+	email, ok := h.privacyTokenOrError(c, c.PostForm("token"))
+	if !ok {
+		return
+	}
+
+	count, err := h.erasePersonalData(email)
+	if err != nil {
+		log.Printf("Error erasing personal data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing data"})
+		return
+	}
+
+	log.Printf("✓ Erased personal data on self-service request (%d signups)", count)
+	c.HTML(http.StatusOK, "privacy.html", gin.H{
+		"Message": "Your data has been erased. We no longer hold your name, email or phone number.",
+	})
+}
+
+func sendPrivacyLinkEmail(email, link string) error {
+	if !emailConfigured() {
+		return nil
+	}
+
+	body := fmt.Sprintf(`
+Hello,
+
+You asked to see the personal data we store about you. This link lets you
+view and download it, or have it erased. It works for 24 hours:
+
+%s
+
+If this wasn't you, simply ignore this email.
+
+Namaste 🙏
+    `, link)
+
+	if err := sendEmail(email, "Your personal data", body, "", ""); err != nil {
+		log.Printf("Failed to send privacy link email: %v", err)
+		return err
+	}
+
+	log.Println("✓ Privacy link email sent")
+	return nil
+}
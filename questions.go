@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of registration questions
+const (
+	QuestionText     = "text"
+	QuestionSelect   = "select"
+	QuestionCheckbox = "checkbox"
+)
+
+const maxAnswerLength = 1000
+
+// WorkshopQuestion is an extra field on a workshop's signup form, e.g.
+// "Any injuries we should know about?". Questions that already have answers
+// are archived instead of deleted, so the answers stay readable.
+type WorkshopQuestion struct {
+	ID         int
+	WorkshopID int
+	Position   int
+	Label      string
+	Kind       string
+	Options    []string // for select
+	Required   bool
+	Archived   bool
+}
+
+// OptionsText is the options one per line, as edited in the admin form
+func (q WorkshopQuestion) OptionsText() string {
+	return strings.Join(q.Options, "\n")
+}
+
+// SignupAnswer is a participant's answer to one question
+type SignupAnswer struct {
+	QuestionID int    `json:"question_id"`
+	Question   string `json:"question"`
+	Answer     string `json:"answer"`
+}
+
+func (a SignupAnswer) String() string {
+	return a.Question + ": " + a.Answer
+}
+
+func splitOptions(text string) []string {
+	var options []string
+	for _, line := range strings.Split(text, "\n") {
+		if option := strings.TrimSpace(line); option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// questionsFromForm reads the question rows of the workshop form. Rows
+// without a question text are left out, so empty rows can be submitted.
+func questionsFromForm(c *gin.Context) ([]WorkshopQuestion, error) {
+	ids := c.PostFormArray("question_id")
+	labels := c.PostFormArray("question_label")
+	kinds := c.PostFormArray("question_kind")
+	options := c.PostFormArray("question_options")
+	required := c.PostFormArray("question_required")
+	if len(labels) != len(ids) || len(kinds) != len(ids) || len(options) != len(ids) || len(required) != len(ids) {
+		return nil, fmt.Errorf("incomplete questions")
+	}
+
+	var questions []WorkshopQuestion
+	for i := range ids {
+		label := strings.TrimSpace(labels[i])
+		if label == "" {
+			continue
+		}
+
+		q := WorkshopQuestion{
+			Position: len(questions),
+			Label:    label,
+			Kind:     kinds[i],
+			Required: required[i] == "true",
+		}
+		q.ID, _ = strconv.Atoi(ids[i])
+
+		switch q.Kind {
+		case QuestionText, QuestionCheckbox:
+		case QuestionSelect:
+			q.Options = splitOptions(options[i])
+			if len(q.Options) == 0 {
+				return nil, fmt.Errorf("question %q needs at least one option", label)
+			}
+		default:
+			return nil, fmt.Errorf("question %q has an unknown type", label)
+		}
+		questions = append(questions, q)
+	}
+	return questions, nil
+}
+
+// saveWorkshopQuestions makes the workshop's questions match the form:
+// existing ones are updated, new ones added and missing ones removed
+func saveWorkshopQuestions(tx *sql.Tx, workshopID int64, questions []WorkshopQuestion) error {
+	var kept []int
+	for _, q := range questions {
+		if q.ID != 0 {
+			result, err := tx.Exec(`
+                UPDATE workshop_questions
+                SET position = ?, label = ?, kind = ?, options = ?, required = ?, archived = 0
+                WHERE id = ? AND workshop_id = ?
+            `, q.Position, q.Label, q.Kind, q.OptionsText(), q.Required, q.ID, workshopID)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n == 1 {
+				kept = append(kept, q.ID)
+				continue
+			}
+		}
+
+		result, err := tx.Exec(`
+            INSERT INTO workshop_questions (workshop_id, position, label, kind, options, required)
+            VALUES (?, ?, ?, ?, ?, ?)
+        `, workshopID, q.Position, q.Label, q.Kind, q.OptionsText(), q.Required)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		kept = append(kept, int(id))
+	}
+
+	rows, err := tx.Query("SELECT id FROM workshop_questions WHERE workshop_id = ? AND archived = 0", workshopID)
+	if err != nil {
+		return err
+	}
+	var removed []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		if !slices.Contains(kept, id) {
+			removed = append(removed, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range removed {
+		_, err := tx.Exec(`
+            DELETE FROM workshop_questions
+            WHERE id = ? AND NOT EXISTS (SELECT 1 FROM signup_answers WHERE question_id = ?)
+        `, id, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE workshop_questions SET archived = 1 WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workshopQuestions returns the questions shown on the workshop's signup form
+func (h *Handlers) workshopQuestions(workshopID int) ([]WorkshopQuestion, error) {
+	rows, err := h.db.Query(`
+        SELECT id, workshop_id, position, label, kind, COALESCE(options, ''), required, archived
+        FROM workshop_questions
+        WHERE workshop_id = ? AND archived = 0
+        ORDER BY position, id
+    `, workshopID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []WorkshopQuestion
+	for rows.Next() {
+		var q WorkshopQuestion
+		var options string
+		err := rows.Scan(&q.ID, &q.WorkshopID, &q.Position, &q.Label, &q.Kind, &options, &q.Required, &q.Archived)
+		if err != nil {
+			return nil, err
+		}
+		q.Options = splitOptions(options)
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// answersFromForm checks the answers against the questions and adds what's
+// wrong to errs, in lang. Checkboxes are recorded as yes or no.
+func answersFromForm(c *gin.Context, questions []WorkshopQuestion, lang string, errs FormErrors) []SignupAnswer {
+	var answers []SignupAnswer
+	for _, q := range questions {
+		field := fmt.Sprintf("answer_%d", q.ID)
+		answer := strings.TrimSpace(c.PostForm(field))
+
+		switch q.Kind {
+		case QuestionCheckbox:
+			if answer == "true" {
+				answer = "yes"
+			} else if q.Required {
+				errs.Add(field, translate(lang, "error.confirm", q.Label))
+				continue
+			} else {
+				answer = "no"
+			}
+		case QuestionSelect:
+			if answer != "" && !slices.Contains(q.Options, answer) {
+				errs.Add(field, translate(lang, "error.pick_option", q.Label))
+				continue
+			}
+		default:
+			if len(answer) > maxAnswerLength {
+				errs.Add(field, translate(lang, "error.answer_too_long", q.Label, maxAnswerLength))
+				continue
+			}
+		}
+
+		if answer == "" {
+			if q.Required {
+				errs.Add(field, translate(lang, "error.answer", q.Label))
+			}
+			continue
+		}
+		answers = append(answers, SignupAnswer{QuestionID: q.ID, Question: q.Label, Answer: answer})
+	}
+	return answers
+}
+
+func recordAnswers(db execer, signupID int64, answers []SignupAnswer) error {
+	for _, a := range answers {
+		_, err := db.Exec(`
+            INSERT INTO signup_answers (signup_id, question_id, answer) VALUES (?, ?, ?)
+        `, signupID, a.QuestionID, a.Answer)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAnswers returns the answers by signup ID. The condition may use s for
+// signups and w for workshops.
+func (h *Handlers) loadAnswers(condition string, args ...any) (map[int][]SignupAnswer, error) {
+	rows, err := h.db.Query(`
+        SELECT a.signup_id, q.id, q.label, a.answer
+        FROM signup_answers a
+        JOIN workshop_questions q ON q.id = a.question_id
+        JOIN signups s ON s.id = a.signup_id
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE `+condition+`
+        ORDER BY a.signup_id, q.position, q.id
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	answers := make(map[int][]SignupAnswer)
+	for rows.Next() {
+		var signupID int
+		var a SignupAnswer
+		if err := rows.Scan(&signupID, &a.QuestionID, &a.Question, &a.Answer); err != nil {
+			return nil, err
+		}
+		answers[signupID] = append(answers[signupID], a)
+	}
+	return answers, rows.Err()
+}
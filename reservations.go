@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SQLite's CURRENT_TIMESTAMP format, so stored times compare with datetime('now')
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// parseDBTime reads a stored UTC time. The driver hands DATETIME columns back
+// as RFC 3339 once they've been through time.Time, plain TEXT stays as stored.
+func parseDBTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(sqliteTimeLayout, value)
+}
+
+// Stripe won't let a Checkout session expire sooner than 30 minutes
+const minHoldDuration = 30 * time.Minute
+
+// seatTakenCondition matches signups that occupy seats right now
+const seatTakenCondition = `(status = 'confirmed' OR
+            (status IN ('pending_payment', 'pending_verification') AND hold_expires_at > datetime('now')))`
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// seatsTaken counts seats rather than signups, a group booking takes several
+func seatsTaken(q queryRower, workshopID int) (int, error) {
+	var count int
+	err := q.QueryRow(`
+        SELECT COALESCE(SUM(seats), 0) FROM signups
+        WHERE workshop_id = ? AND `+seatTakenCondition,
+		workshopID).Scan(&count)
+	return count, err
+}
+
+// seatsStillFree tells whether the seats of a signup whose hold ran out are
+// still free, in every session if it's part of a course enrollment
+func seatsStillFree(tx *sql.Tx, signupID int) (bool, error) {
+	rows, err := tx.Query(`
+        SELECT s.workshop_id, s.seats, w.max_capacity
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.id = ? OR s.course_enrollment_id = (SELECT course_enrollment_id FROM signups WHERE id = ?)
+    `, signupID, signupID)
+	if err != nil {
+		return false, err
+	}
+
+	type booking struct{ workshopID, seats, capacity int }
+	var bookings []booking
+	for rows.Next() {
+		var b booking
+		if err := rows.Scan(&b.workshopID, &b.seats, &b.capacity); err != nil {
+			rows.Close()
+			return false, err
+		}
+		bookings = append(bookings, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, b := range bookings {
+		taken, err := seatsTaken(tx, b.workshopID)
+		if err != nil {
+			return false, err
+		}
+		if taken+b.seats > b.capacity {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// holdDurationFromEnv returns how long a seat is held while the participant pays
+func holdDurationFromEnv() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("PAYMENT_HOLD_MINUTES"))
+	if err != nil {
+		return minHoldDuration
+	}
+
+	hold := time.Duration(minutes) * time.Minute
+	if hold < minHoldDuration {
+		log.Printf("⚠️  PAYMENT_HOLD_MINUTES must be at least 30, using 30")
+		return minHoldDuration
+	}
+	return hold
+}
+
+// startHoldSweeper periodically marks unpaid and unverified holds as expired
+// so the seats show up as free again in the admin panel and exports.
+func startHoldSweeper(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			expireHolds(db)
+		}
+	}()
+}
+
+func expireHolds(db *sql.DB) {
+	result, err := db.Exec(`
+        UPDATE signups SET status = 'expired'
+        WHERE status IN ('pending_payment', 'pending_verification') AND hold_expires_at <= datetime('now')
+    `)
+	if err != nil {
+		log.Printf("Error expiring seat holds: %v", err)
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Released %d expired seat hold(s)", n)
+	}
+}
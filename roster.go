@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+)
+
+// Column layout of the roster table on A4 portrait, widths in mm
+var rosterColumns = []struct {
+	Title string
+	Width float64
+}{
+	{"#", 10},
+	{"Name", 50},
+	{"Email", 55},
+	{"Phone", 30},
+	{"Present", 15},
+	{"Signature", 30},
+}
+
+const rosterRowHeight = 9
+
+// RosterPDFHandler renders a printable sign-in sheet of confirmed participants
+func (h *Handlers) RosterPDFHandler(c *gin.Context) {
+	workshopID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+
+	var workshop Workshop
+	err = h.db.QueryRow(`
+        SELECT id, title, date, location, max_capacity FROM workshops WHERE id = ?
+    `, workshopID).Scan(&workshop.ID, &workshop.Title, &workshop.Date, &workshop.Location, &workshop.MaxCapacity)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading workshop %d: %v", workshopID, err)
+		c.String(http.StatusInternalServerError, "Error loading workshop: %v", err)
+		return
+	}
+
+	rows, err := h.db.Query(`
+        SELECT id, first_name, last_name, email, phone, seats, COALESCE(attended_at, '')
+        FROM signups
+        WHERE workshop_id = ? AND status = 'confirmed'
+        ORDER BY last_name COLLATE NOCASE, first_name COLLATE NOCASE
+    `, workshopID)
+	if err != nil {
+		log.Printf("Error querying signups for roster: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading signups: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var signups []Signup
+	for rows.Next() {
+		var s Signup
+		if err := rows.Scan(&s.ID, &s.FirstName, &s.LastName, &s.Email, &s.Phone, &s.Seats, &s.AttendedAt); err != nil {
+			log.Printf("Error scanning roster row: %v", err)
+			continue
+		}
+		signups = append(signups, s)
+	}
+
+	guests, err := h.loadGuests("w.id = ?", workshopID)
+	if err != nil {
+		log.Printf("Error loading guests for roster: %v", err)
+	}
+	for i := range signups {
+		signups[i].Guests = guests[signups[i].ID]
+	}
+
+	pdf := buildRosterPDF(workshop, signups)
+	if err := pdf.Error(); err != nil {
+		log.Printf("Error building roster PDF: %v", err)
+		c.String(http.StatusInternalServerError, "Error building roster: %v", err)
+		return
+	}
+
+	filename := fmt.Sprintf("roster-%d.pdf", workshop.ID)
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s", filename))
+	if err := pdf.Output(c.Writer); err != nil {
+		log.Printf("Error writing roster PDF: %v", err)
+	}
+}
+
+func buildRosterPDF(workshop Workshop, signups []Signup) *fpdf.Fpdf {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(workshop.Title+" - Roster", true)
+	pdf.SetMargins(10, 15, 10)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AliasNbPages("")
+
+	// The core fonts only know cp1252, which covers the accents in our names
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(0, 8, tr(workshop.Title), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(0, 6, tr(workshop.Date), "", 1, "L", false, 0, "")
+		pdf.CellFormat(0, 6, tr(workshop.Location), "", 1, "L", false, 0, "")
+		pdf.Ln(4)
+
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.SetFillColor(232, 227, 220)
+		for _, col := range rosterColumns {
+			pdf.CellFormat(col.Width, rosterRowHeight, col.Title, "1", 0, "L", true, 0, "")
+		}
+		pdf.Ln(-1)
+	})
+
+	participants := 0
+	for _, s := range signups {
+		participants += max(s.Seats, 1)
+	}
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(95, 6, fmt.Sprintf("%d participants", participants), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 10)
+
+	// Guests get their own line below the person who booked them
+	row := 0
+	for _, s := range signups {
+		booker := s.FirstName + " " + s.LastName
+		for j, name := range s.Attendees() {
+			row++
+			values := []string{strconv.Itoa(row), name, s.Email, formatPhone(s.Phone), "", ""}
+			if j > 0 {
+				values[2], values[3] = "guest of "+booker, ""
+			}
+			for k, col := range rosterColumns {
+				pdf.CellFormat(col.Width, rosterRowHeight, fitText(pdf, tr(values[k]), col.Width-2),
+					"1", 0, "L", false, 0, "")
+			}
+
+			// Tick box in the Present column, pre-ticked for people already checked in
+			x := pdf.GetX() - rosterColumns[5].Width - rosterColumns[4].Width/2 - 2
+			y := pdf.GetY() + rosterRowHeight/2 - 2
+			pdf.Rect(x, y, 4, 4, "D")
+			if s.AttendedAt != "" {
+				pdf.Line(x+0.8, y+2, x+1.8, y+3.2)
+				pdf.Line(x+1.8, y+3.2, x+3.4, y+0.8)
+			}
+
+			pdf.Ln(-1)
+		}
+	}
+
+	// Blank lines for walk-ins, up to the workshop's capacity
+	for i := row; i < workshop.MaxCapacity && i < row+5; i++ {
+		for _, col := range rosterColumns {
+			pdf.CellFormat(col.Width, rosterRowHeight, "", "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	return pdf
+}
+
+// fitText shortens s with an ellipsis so it fits into width mm
+func fitText(pdf *fpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	for len(s) > 0 && pdf.GetStringWidth(s+"...") > width {
+		s = strings.TrimRight(s[:len(s)-1], " ")
+	}
+	return s + "..."
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Upper bound for a single series, about two years of weekly classes
+const maxSeriesOccurrences = 104
+
+// Recurrence is a small subset of an iCalendar RRULE: weekly, every other
+// week, or monthly on the nth (or last) weekday, ending on a date or after a
+// number of workshops, with single dates skipped.
+type Recurrence struct {
+	Freq      string // weekly, biweekly or monthly
+	Nth       int    // monthly only: 1-4, or -1 for the last weekday of the month
+	Start     time.Time
+	Until     time.Time // last day that may have a workshop, zero for none
+	Count     int       // number of workshops to create, 0 for none
+	SkipDates map[string]bool
+}
+
+func parseRecurrence(freq string, nth int, start time.Time, until string, count int, skipDates string) (Recurrence, error) {
+	r := Recurrence{Freq: freq, Nth: nth, Start: start, Count: count, SkipDates: map[string]bool{}}
+
+	if until != "" {
+		day, err := time.ParseInLocation("2006-01-02", until, time.Local)
+		if err != nil {
+			return r, errors.New("invalid end date")
+		}
+		r.Until = day
+		if day.Before(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())) {
+			return r, errors.New("the end date is before the first workshop")
+		}
+	}
+	if r.Until.IsZero() && r.Count == 0 {
+		return r, errors.New("a series needs an end date or a number of workshops")
+	}
+
+	for _, skip := range strings.FieldsFunc(skipDates, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		if _, err := time.Parse("2006-01-02", skip); err != nil {
+			return r, fmt.Errorf("invalid skip date %q, use YYYY-MM-DD", skip)
+		}
+		r.SkipDates[skip] = true
+	}
+
+	if r.Freq == "monthly" && r.Nth == 0 {
+		// Default to the weekday position of the first workshop, e.g. 2nd Saturday
+		r.Nth = (start.Day()-1)/7 + 1
+		if r.Nth > 4 {
+			r.Nth = -1
+		}
+	}
+
+	if len(r.Occurrences()) == 0 {
+		return r, errors.New("no workshop falls between the start and end date, or all of them are skipped")
+	}
+
+	return r, nil
+}
+
+// Occurrences returns the start times of all workshops in the series
+func (r Recurrence) Occurrences() []time.Time {
+	var occurrences []time.Time
+	for i := 0; len(occurrences) < maxSeriesOccurrences; i++ {
+		t := r.occurrence(i)
+		if !r.Until.IsZero() && !t.Before(r.Until.AddDate(0, 0, 1)) {
+			break
+		}
+		if r.Count > 0 && len(occurrences) >= r.Count {
+			break
+		}
+		if r.SkipDates[t.Format("2006-01-02")] {
+			continue
+		}
+		occurrences = append(occurrences, t)
+	}
+	return occurrences
+}
+
+func (r Recurrence) occurrence(i int) time.Time {
+	switch r.Freq {
+	case "biweekly":
+		return r.Start.AddDate(0, 0, 14*i)
+	case "monthly":
+		return nthWeekdayOfMonth(r.Start, i, r.Nth)
+	default:
+		return r.Start.AddDate(0, 0, 7*i)
+	}
+}
+
+// nthWeekdayOfMonth finds the nth weekday of start's weekday, monthsAhead
+// months after start, keeping the time of day
+func nthWeekdayOfMonth(start time.Time, monthsAhead int, nth int) time.Time {
+	first := time.Date(start.Year(), start.Month()+time.Month(monthsAhead), 1,
+		start.Hour(), start.Minute(), 0, 0, start.Location())
+
+	if nth == -1 {
+		last := first.AddDate(0, 1, -1)
+		offset := (int(last.Weekday()) - int(start.Weekday()) + 7) % 7
+		return last.AddDate(0, 0, -offset)
+	}
+
+	offset := (int(start.Weekday()) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+7*(nth-1))
+}
+
+// createSeries stores the series and all of its workshops in one go. Every
+// workshop gets its own copy of the registration questions.
+func (h *Handlers) createSeries(w Workshop, r Recurrence, questions []WorkshopQuestion,
+	translations []WorkshopTranslation) (int64, error) {
+	occurrences := r.Occurrences()
+	if len(occurrences) == 0 {
+		return 0, errors.New("series has no workshops")
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var until, count any
+	if !r.Until.IsZero() {
+		until = r.Until.Format("2006-01-02")
+	}
+	if r.Count > 0 {
+		count = r.Count
+	}
+	skipDates := make([]string, 0, len(r.SkipDates))
+	for day := range r.SkipDates {
+		skipDates = append(skipDates, day)
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO workshop_series (title, freq, nth, starts_on, start_time, until, count, skip_dates)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, w.Title, r.Freq, nullableID(r.Nth), r.Start.Format("2006-01-02"), r.Start.Format("15:04"),
+		until, count, strings.Join(skipDates, ","))
+	if err != nil {
+		return 0, err
+	}
+
+	seriesID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	w.SeriesID = int(seriesID)
+
+	for _, startsAt := range occurrences {
+		workshopID, err := insertWorkshop(tx, w, startsAt)
+		if err != nil {
+			return 0, err
+		}
+		if err := saveWorkshopQuestions(tx, workshopID, questions); err != nil {
+			return 0, err
+		}
+		if err := saveWorkshopTranslations(tx, workshopID, translations); err != nil {
+			return 0, err
+		}
+	}
+
+	return seriesID, tx.Commit()
+}
+
+// EditWorkshopHandler shows the edit form for a single workshop
+func (h *Handlers) EditWorkshopHandler(c *gin.Context) {
+	workshopID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+
+	w, err := h.loadEditableWorkshop(workshopID)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading workshop %d: %v", workshopID, err)
+		c.String(http.StatusInternalServerError, "Error loading workshop: %v", err)
+		return
+	}
+
+	questions, err := h.workshopQuestions(w.ID)
+	if err != nil {
+		log.Printf("Error loading questions: %v", err)
+	}
+	translations, err := h.workshopTranslations(w.ID)
+	if err != nil {
+		log.Printf("Error loading translations: %v", err)
+	}
+
+	page := h.workshopEditPage(w)
+	page["Questions"] = questions
+	page["Translations"] = translationFields(translations)
+	c.HTML(http.StatusOK, "workshop_edit.html", page)
+}
+
+func (h *Handlers) loadEditableWorkshop(workshopID int) (Workshop, error) {
+	var w Workshop
+	err := h.db.QueryRow(`
+        SELECT id, title, description, date, location, max_capacity, max_seats_per_booking,
+               verify_email, price_cents, currency, COALESCE(starts_at, ''), COALESCE(series_id, 0)
+        FROM workshops
+        WHERE id = ?
+    `, workshopID).Scan(&w.ID, &w.Title, &w.Description, &w.Date, &w.Location, &w.MaxCapacity,
+		&w.MaxSeatsPerBooking, &w.VerifyEmail, &w.PriceCents, &w.Currency, &w.StartsAt, &w.SeriesID)
+	return w, err
+}
+
+// workshopEditPage is what workshop_edit.html needs, with the form filled in
+// from the stored workshop
+func (h *Handlers) workshopEditPage(w Workshop) gin.H {
+	// Split the stored start time for the date and time inputs
+	workshopDate, workshopTime, _ := strings.Cut(w.StartsAt, " ")
+
+	form := FormValues{
+		"title":                 {w.Title},
+		"description":           {w.Description},
+		"workshop_date":         {workshopDate},
+		"workshop_time":         {workshopTime},
+		"location":              {w.Location},
+		"max_capacity":          {strconv.Itoa(w.MaxCapacity)},
+		"max_seats_per_booking": {strconv.Itoa(w.MaxSeatsPerBooking)},
+		"price":                 {formatAmount(w.PriceCents)},
+		"currency":              {w.Currency},
+	}
+	if w.VerifyEmail {
+		form["verify_email"] = []string{"true"}
+	}
+
+	var following int
+	if w.SeriesID != 0 {
+		h.db.QueryRow(`
+            SELECT COUNT(*) FROM workshops WHERE series_id = ? AND starts_at > ?
+        `, w.SeriesID, w.StartsAt).Scan(&following)
+	}
+
+	return gin.H{
+		"Workshop":  w,
+		"Form":      form,
+		"Following": following,
+	}
+}
+
+// UpdateWorkshopHandler saves an edited workshop. For series, scope=following
+// applies the changes to this and all later workshops of the series, each
+// keeping its own date.
+func (h *Handlers) UpdateWorkshopHandler(c *gin.Context) {
+	workshopID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+
+	current, err := h.loadEditableWorkshop(workshopID)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "Workshop not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading workshop %d: %v", workshopID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating workshop"})
+		return
+	}
+	seriesID, startsAt := current.SeriesID, current.StartsAt
+
+	var form struct {
+		Title        string `form:"title" binding:"required"`
+		Description  string `form:"description" binding:"required"`
+		WorkshopDate string `form:"workshop_date" binding:"required"`
+		WorkshopTime string `form:"workshop_time" binding:"required"`
+		Location     string `form:"location" binding:"required"`
+		MaxCapacity  int    `form:"max_capacity" binding:"required,min=1"`
+		MaxSeats     int    `form:"max_seats_per_booking" binding:"omitempty,min=1,max=10"`
+		VerifyEmail  bool   `form:"verify_email"`
+		Price        string `form:"price"`
+		Currency     string `form:"currency" binding:"required,oneof=CHF EUR"`
+		Scope        string `form:"scope" binding:"omitempty,oneof=this following"`
+	}
+
+	// Admin pages are in English
+	errs := FormErrors{}
+	if err := c.ShouldBind(&form); err != nil {
+		errs = bindErrors(&form, err, fallbackLanguage)
+	}
+
+	questions, err := questionsFromForm(c)
+	if err != nil {
+		errs.Add("questions", err.Error())
+	}
+	translations := translationsFromForm(c)
+
+	var dateTime time.Time
+	if form.WorkshopDate != "" && form.WorkshopTime != "" {
+		dateTime, err = time.ParseInLocation(startsAtLayout, form.WorkshopDate+" "+form.WorkshopTime, time.Local)
+		if err != nil {
+			errs.Add("workshop_date", "Invalid date or time format")
+		}
+	}
+
+	priceCents, err := parsePriceCents(form.Price)
+	if err != nil {
+		errs.Add("price", "Invalid price")
+	}
+
+	if len(errs) > 0 {
+		page := h.workshopEditPage(current)
+		page["Form"] = formValues(c)
+		page["Errors"] = errs
+		page["Questions"] = questions
+		page["Translations"] = translationFields(translations)
+		c.HTML(http.StatusBadRequest, "workshop_edit.html", page)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Printf("Error starting workshop update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating workshop"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+        UPDATE workshops
+        SET title = ?, description = ?, date = ?, location = ?, max_capacity = ?,
+            max_seats_per_booking = ?, verify_email = ?, price_cents = ?, currency = ?, starts_at = ?
+        WHERE id = ?
+    `, form.Title, form.Description, dateTime.Format(workshopDateLayout), form.Location,
+		form.MaxCapacity, max(form.MaxSeats, 1), form.VerifyEmail, priceCents, form.Currency, dateTime.Format(startsAtLayout), workshopID)
+	if err != nil {
+		log.Printf("Error updating workshop %d: %v", workshopID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating workshop"})
+		return
+	}
+
+	// Questions belong to this workshop only, later ones of a series keep theirs
+	if err := saveWorkshopQuestions(tx, int64(workshopID), questions); err != nil {
+		log.Printf("Error saving questions of workshop %d: %v", workshopID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating workshop"})
+		return
+	}
+	if err := saveWorkshopTranslations(tx, int64(workshopID), translations); err != nil {
+		log.Printf("Error saving translations of workshop %d: %v", workshopID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating workshop"})
+		return
+	}
+
+	if form.Scope == "following" && seriesID != 0 {
+		edited := Workshop{
+			ID:                 workshopID,
+			Title:              form.Title,
+			Description:        form.Description,
+			Location:           form.Location,
+			MaxCapacity:        form.MaxCapacity,
+			MaxSeatsPerBooking: max(form.MaxSeats, 1),
+			VerifyEmail:        form.VerifyEmail,
+			PriceCents:         priceCents,
+			Currency:           form.Currency,
+			SeriesID:           seriesID,
+		}
+		if err := updateFollowingWorkshops(tx, edited, translations, startsAt, dateTime); err != nil {
+			log.Printf("Error updating series %d: %v", seriesID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating workshop series"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing workshop update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating workshop"})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin?workshop=%d", workshopID))
+}
+
+// updateFollowingWorkshops copies the edited details and translations to
+// later workshops of the series. Each keeps its date but takes over the new
+// time of day.
+func updateFollowingWorkshops(tx *sql.Tx, edited Workshop, translations []WorkshopTranslation,
+	after string, timeOfDay time.Time) error {
+	rows, err := tx.Query(`
+        SELECT id, starts_at FROM workshops
+        WHERE series_id = ? AND starts_at > ? AND id != ?
+    `, edited.SeriesID, after, edited.ID)
+	if err != nil {
+		return err
+	}
+
+	following := map[int]time.Time{}
+	for rows.Next() {
+		var id int
+		var startsAt string
+		if err := rows.Scan(&id, &startsAt); err != nil {
+			rows.Close()
+			return err
+		}
+		day, err := time.ParseInLocation(startsAtLayout, startsAt, time.Local)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		following[id] = time.Date(day.Year(), day.Month(), day.Day(),
+			timeOfDay.Hour(), timeOfDay.Minute(), 0, 0, time.Local)
+	}
+	rows.Close()
+
+	for id, startsAt := range following {
+		_, err := tx.Exec(`
+            UPDATE workshops
+            SET title = ?, description = ?, date = ?, location = ?, max_capacity = ?,
+                max_seats_per_booking = ?, verify_email = ?, price_cents = ?, currency = ?, starts_at = ?
+            WHERE id = ?
+        `, edited.Title, edited.Description, startsAt.Format(workshopDateLayout), edited.Location,
+			edited.MaxCapacity, edited.MaxSeatsPerBooking, edited.VerifyEmail, edited.PriceCents, edited.Currency,
+			startsAt.Format(startsAtLayout), id)
+		if err != nil {
+			return err
+		}
+		if err := saveWorkshopTranslations(tx, int64(id), translations); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+)
+
+// loadSigningKey returns the key used to sign links we hand out, e.g. check-in
+// codes. SIGNING_SECRET wins; otherwise a random key is created once and kept
+// in the database so links stay valid across restarts.
+func loadSigningKey(db *sql.DB) []byte {
+	if secret := os.Getenv("SIGNING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	var secret string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = 'signing_key'").Scan(&secret)
+	if err == nil {
+		return []byte(secret)
+	}
+	if err != sql.ErrNoRows {
+		log.Fatal(err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatal(err)
+	}
+	secret = hex.EncodeToString(buf)
+
+	// Another instance may have raced us here, keep whichever key won
+	db.Exec("INSERT OR IGNORE INTO settings (key, value) VALUES ('signing_key', ?)", secret)
+	if err := db.QueryRow("SELECT value FROM settings WHERE key = 'signing_key'").Scan(&secret); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("✓ Signing key created")
+	return []byte(secret)
+}
+
+// signToken returns payload with an HMAC appended. The purpose is part of the
+// signature, so a token made for one use can't be replayed for another.
+func signToken(key []byte, purpose, payload string) string {
+	return payload + "." + tokenSignature(key, purpose, payload)
+}
+
+// verifyToken checks a token made by signToken and returns its payload
+func verifyToken(key []byte, purpose, token string) (string, bool) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", false
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(tokenSignature(key, purpose, payload))) {
+		return "", false
+	}
+	return payload, true
+}
+
+func tokenSignature(key []byte, purpose, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose + ":" + payload))
+	// 128 bits is plenty and keeps QR codes and links short
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/sha256"
+	"log"
+	"math/bits"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The public signup forms carry a few checks against bots: a honeypot field
+// people never see, a signed timestamp so forms can't be sent faster than a
+// person types, a limit per IP address and, if SIGNUP_POW_BITS is set, a
+// proof-of-work the browser has to solve before sending.
+
+const (
+	formTokenPurpose = "signup-form"
+	honeypotField    = "website"
+	maxFormAge       = 24 * time.Hour
+	// Blocked attempts are kept this long, they include IP addresses
+	blockedRetention = 30 * 24 * time.Hour
+)
+
+// spamReason says why a signup was blocked, empty if it wasn't
+type spamReason string
+
+const (
+	spamHoneypot     spamReason = "honeypot"
+	spamTooFast      spamReason = "too_fast"
+	spamBadToken     spamReason = "bad_token"
+	spamRateLimited  spamReason = "rate_limited"
+	spamProofOfWork  spamReason = "proof_of_work"
+	spamExpiredToken spamReason = "expired"
+)
+
+func (r spamReason) Status() int {
+	if r == spamRateLimited {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
+
+// MessageKey is what people who got blocked by mistake are told
+func (r spamReason) MessageKey() string {
+	switch r {
+	case spamTooFast:
+		return "error.spam.too_fast"
+	case spamRateLimited:
+		return "error.spam.rate_limited"
+	case spamProofOfWork:
+		return "error.spam.proof_of_work"
+	default:
+		return "error.spam.expired"
+	}
+}
+
+// spamGuard holds the settings and the state of the checks
+type spamGuard struct {
+	minFillTime time.Duration
+	powBits     int
+	limiter     *rateLimiter
+
+	mu        sync.Mutex
+	usedProof map[string]time.Time
+}
+
+func newSpamGuardFromEnv() *spamGuard {
+	g := &spamGuard{
+		minFillTime: 3 * time.Second,
+		limiter:     newRateLimiter(10, time.Hour),
+		usedProof:   map[string]time.Time{},
+	}
+	// SIGNUP_MIN_FILL_SECONDS: forms sent faster than this are from bots
+	if seconds, err := strconv.Atoi(os.Getenv("SIGNUP_MIN_FILL_SECONDS")); err == nil && seconds >= 0 {
+		g.minFillTime = time.Duration(seconds) * time.Second
+	}
+	// SIGNUP_RATE_PER_HOUR: signup attempts allowed per IP address
+	if rate, err := strconv.Atoi(os.Getenv("SIGNUP_RATE_PER_HOUR")); err == nil && rate > 0 {
+		g.limiter = newRateLimiter(rate, time.Hour)
+	}
+	// SIGNUP_POW_BITS: leading zero bits of the proof-of-work, 16 takes a
+	// phone about a second. Off when empty or 0.
+	if powBits, err := strconv.Atoi(os.Getenv("SIGNUP_POW_BITS")); err == nil && powBits > 0 {
+		if powBits > 24 {
+			log.Printf("⚠️  SIGNUP_POW_BITS above 24 takes too long on phones, using 24")
+			powBits = 24
+		}
+		g.powBits = powBits
+		log.Printf("✓ Signup forms require a proof-of-work of %d bits", powBits)
+	}
+	return g
+}
+
+// formToken is handed out with every signup form, it's the signed time the
+// form was shown
+func (h *Handlers) formToken() string {
+	return signToken(h.signingKey, formTokenPurpose, strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+// spamFields is what the spam_fields template needs
+func (h *Handlers) spamFields() gin.H {
+	return gin.H{
+		"Honeypot":    honeypotField,
+		"Token":       h.formToken(),
+		"ProofOfWork": h.spam.powBits,
+	}
+}
+
+// checkSpam runs the checks on a posted signup form. Blocked attempts are
+// logged and recorded for the admins.
+func (h *Handlers) checkSpam(c *gin.Context, form, email string) spamReason {
+	reason := h.spam.check(c, h.signingKey, time.Now())
+	if reason != "" {
+		h.recordBlockedSignup(c, form, email, reason)
+	}
+	return reason
+}
+
+func (g *spamGuard) check(c *gin.Context, key []byte, now time.Time) spamReason {
+	// Counted first, so bots can't get around it by failing other checks
+	if !g.limiter.Allow(c.ClientIP(), now) {
+		return spamRateLimited
+	}
+	if c.PostForm(honeypotField) != "" {
+		return spamHoneypot
+	}
+
+	token := c.PostForm("form_token")
+	payload, ok := verifyToken(key, formTokenPurpose, token)
+	if !ok {
+		return spamBadToken
+	}
+	shownAt, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return spamBadToken
+	}
+	age := now.Sub(time.Unix(shownAt, 0))
+	if age < g.minFillTime {
+		return spamTooFast
+	}
+	if age > maxFormAge {
+		return spamExpiredToken
+	}
+
+	if g.powBits > 0 {
+		nonce := c.PostForm("pow_nonce")
+		if !validProofOfWork(token, nonce, g.powBits) || !g.useProof(token, now) {
+			return spamProofOfWork
+		}
+	}
+	return ""
+}
+
+// validProofOfWork checks that SHA-256 of "token:nonce" starts with at least
+// powBits zero bits, see static/pow.js
+func validProofOfWork(token, nonce string, powBits int) bool {
+	if nonce == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token + ":" + nonce))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= powBits
+}
+
+// useProof makes each solved token good for one signup only
+func (g *spamGuard) useProof(token string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for t, expires := range g.usedProof {
+		if now.After(expires) {
+			delete(g.usedProof, t)
+		}
+	}
+	if _, used := g.usedProof[token]; used {
+		return false
+	}
+	g.usedProof[token] = now.Add(maxFormAge)
+	return true
+}
+
+// rateLimiter allows a number of events per key within a sliding window
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	events map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, events: map[string][]time.Time{}}
+}
+
+func (l *rateLimiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget what's out of the window, for every key so the map stays small
+	for k, times := range l.events {
+		i := 0
+		for i < len(times) && now.Sub(times[i]) >= l.window {
+			i++
+		}
+		if i == len(times) {
+			delete(l.events, k)
+		} else {
+			l.events[k] = times[i:]
+		}
+	}
+
+	if len(l.events[key]) >= l.limit {
+		return false
+	}
+	l.events[key] = append(l.events[key], now)
+	return true
+}
+
+func (h *Handlers) recordBlockedSignup(c *gin.Context, form, email string, reason spamReason) {
+	log.Printf("⚠️  Blocked %s from %s: %s", form, c.ClientIP(), reason)
+
+	_, err := h.db.Exec(`
+        INSERT INTO blocked_signups (form, reason, ip, email, user_agent) VALUES (?, ?, ?, ?, ?)
+    `, form, reason, c.ClientIP(), email, c.Request.UserAgent())
+	if err == nil {
+		_, err = h.db.Exec("DELETE FROM blocked_signups WHERE created_at < ?",
+			time.Now().UTC().Add(-blockedRetention).Format(sqliteTimeLayout))
+	}
+	if err != nil {
+		log.Printf("Error recording blocked signup: %v", err)
+	}
+}
+
+// BlockedSignup is a signup attempt the spam checks stopped
+type BlockedSignup struct {
+	Form      string
+	Reason    string
+	IP        string
+	Email     string
+	UserAgent string
+	CreatedAt string
+}
+
+// BlockedCount is how often a reason blocked signups recently
+type BlockedCount struct {
+	Reason string
+	Count  int
+}
+
+// AdminSpamHandler lists recently blocked signup attempts
+func (h *Handlers) AdminSpamHandler(c *gin.Context) {
+	rows, err := h.db.Query(`
+        SELECT form, reason, ip, COALESCE(email, ''), COALESCE(user_agent, ''), created_at
+        FROM blocked_signups
+        ORDER BY created_at DESC, id DESC
+        LIMIT 200
+    `)
+	if err != nil {
+		log.Printf("Error loading blocked signups: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading blocked signups")
+		return
+	}
+	defer rows.Close()
+
+	var blocked []BlockedSignup
+	for rows.Next() {
+		var b BlockedSignup
+		if err := rows.Scan(&b.Form, &b.Reason, &b.IP, &b.Email, &b.UserAgent, &b.CreatedAt); err != nil {
+			log.Printf("Error scanning blocked signup: %v", err)
+			continue
+		}
+		blocked = append(blocked, b)
+	}
+
+	countRows, err := h.db.Query(`
+        SELECT reason, COUNT(*) FROM blocked_signups
+        WHERE created_at >= ?
+        GROUP BY reason
+        ORDER BY COUNT(*) DESC
+    `, time.Now().UTC().AddDate(0, 0, -7).Format(sqliteTimeLayout))
+	if err != nil {
+		log.Printf("Error counting blocked signups: %v", err)
+		c.String(http.StatusInternalServerError, "Error loading blocked signups")
+		return
+	}
+	defer countRows.Close()
+
+	var counts []BlockedCount
+	for countRows.Next() {
+		var bc BlockedCount
+		if err := countRows.Scan(&bc.Reason, &bc.Count); err != nil {
+			log.Printf("Error scanning blocked count: %v", err)
+			continue
+		}
+		counts = append(counts, bc)
+	}
+
+	c.HTML(http.StatusOK, "admin_spam.html", gin.H{
+		"Blocked":     blocked,
+		"Counts":      counts,
+		"ProofOfWork": h.spam.powBits,
+		"RateLimit":   h.spam.limiter.limit,
+	})
+}
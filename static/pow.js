@@ -0,0 +1,42 @@
+// Solves the proof-of-work of signup forms with data-pow before sending them:
+// find a nonce so that SHA-256 of "token:nonce" starts with data-pow zero
+// bits. The server checks the same in validProofOfWork.
+document.querySelectorAll("form[data-pow]").forEach((form) => {
+  form.addEventListener("submit", async (event) => {
+    const nonceInput = form.querySelector('input[name="pow_nonce"]');
+    if (nonceInput.value) {
+      return;
+    }
+    event.preventDefault();
+
+    const button = form.querySelector('button[type="submit"]');
+    button.disabled = true;
+
+    const token = form.querySelector('input[name="form_token"]').value;
+    const bits = Number(form.dataset.pow);
+    const encoder = new TextEncoder();
+    for (let nonce = 0; ; nonce++) {
+      const digest = await crypto.subtle.digest(
+        "SHA-256",
+        encoder.encode(token + ":" + nonce),
+      );
+      if (leadingZeroBits(new Uint8Array(digest)) >= bits) {
+        nonceInput.value = String(nonce);
+        break;
+      }
+    }
+    form.submit();
+  });
+});
+
+function leadingZeroBits(bytes) {
+  let zeros = 0;
+  for (const b of bytes) {
+    if (b === 0) {
+      zeros += 8;
+      continue;
+    }
+    return zeros + Math.clz32(b) - 24;
+  }
+  return zeros;
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stripe rejects signatures older than this by default, we do the same
+const stripeSignatureTolerance = 5 * time.Minute
+
+const checkoutCancelPurpose = "cancel-checkout"
+
+// StripeClient talks to the parts of the Stripe API we need for Checkout.
+// The API base is configurable so a local fake can stand in for Stripe.
+type StripeClient struct {
+	apiBase       string
+	secretKey     string
+	webhookSecret string
+	httpClient    *http.Client
+}
+
+type checkoutParams struct {
+	SignupID    int
+	Email       string
+	Title       string
+	AmountCents int
+	Currency    string
+	SuccessURL  string
+	CancelURL   string
+	ExpiresAt   time.Time
+	Locale      string // language of the payment page, Stripe picks one if empty
+}
+
+type checkoutSession struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	PaymentStatus     string `json:"payment_status"`
+	ClientReferenceID string `json:"client_reference_id"`
+	AmountTotal       int    `json:"amount_total"`
+	Currency          string `json:"currency"`
+}
+
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// newStripeClientFromEnv returns nil when Stripe isn't configured, in which
+// case paid workshops are confirmed right away and collected offline.
+func newStripeClientFromEnv() *StripeClient {
+	secretKey := os.Getenv("STRIPE_SECRET_KEY")
+	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+
+	if secretKey == "" {
+		return nil
+	}
+	if webhookSecret == "" {
+		log.Println("⚠️  STRIPE_WEBHOOK_SECRET not set, Stripe Checkout disabled")
+		return nil
+	}
+
+	apiBase := os.Getenv("STRIPE_API_BASE")
+	if apiBase == "" {
+		apiBase = "https://api.stripe.com"
+	}
+
+	return &StripeClient{
+		apiBase:       strings.TrimRight(apiBase, "/"),
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (s *StripeClient) CreateCheckoutSession(p checkoutParams) (*checkoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", p.SuccessURL)
+	form.Set("cancel_url", p.CancelURL)
+	form.Set("customer_email", p.Email)
+	form.Set("client_reference_id", strconv.Itoa(p.SignupID))
+	form.Set("expires_at", strconv.FormatInt(p.ExpiresAt.Unix(), 10))
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(p.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.Itoa(p.AmountCents))
+	form.Set("line_items[0][price_data][product_data][name]", p.Title)
+	form.Set("metadata[signup_id]", strconv.Itoa(p.SignupID))
+	if p.Locale != "" {
+		form.Set("locale", p.Locale)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.apiBase+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Retrying the same signup must never create a second session
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("checkout-signup-%d", p.SignupID))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("stripe returned %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	var session checkoutSession
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	if session.ID == "" || session.URL == "" {
+		return nil, errors.New("stripe returned a session without id or url")
+	}
+
+	return &session, nil
+}
+
+// ExpireCheckoutSession closes a session so it can no longer be paid
+func (s *StripeClient) ExpireCheckoutSession(sessionID string) error {
+	req, err := http.NewRequest(http.MethodPost,
+		s.apiBase+"/v1/checkout/sessions/"+url.PathEscape(sessionID)+"/expire", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("stripe returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// VerifyWebhook checks the Stripe-Signature header against the raw payload.
+// The header looks like "t=1700000000,v1=<hex hmac>,v1=<hex hmac>".
+func (s *StripeClient) VerifyWebhook(payload []byte, header string) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("missing signature")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	age := time.Since(time.Unix(ts, 0))
+	if age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("no matching signature")
+}
+
+// startCheckout sends the participant to Stripe to pay for a held seat. If
+// Stripe fails, the hold is released and the caller shows the error.
+func (h *Handlers) startCheckout(c *gin.Context, signup Signup, workshop Workshop, holdExpiresAt time.Time) error {
+	title := workshop.Title
+	if signup.Seats > 1 {
+		title = fmt.Sprintf("%s × %d", workshop.Title, signup.Seats)
+	}
+
+	checkoutURL, err := h.createCheckout(c, signup, title, workshop.Currency, holdExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	c.Redirect(http.StatusSeeOther, checkoutURL)
+	return nil
+}
+
+// createCheckout opens a Checkout session for signup.PriceCents and returns
+// where to send the participant. If Stripe fails the hold is released.
+func (h *Handlers) createCheckout(c *gin.Context, signup Signup, title, currency string, holdExpiresAt time.Time) (string, error) {
+	base := baseURL(c)
+	cancelToken := signToken(h.signingKey, checkoutCancelPurpose, strconv.Itoa(signup.ID))
+	session, err := h.stripe.CreateCheckoutSession(checkoutParams{
+		SignupID:    signup.ID,
+		Email:       signup.Email,
+		Title:       title,
+		AmountCents: signup.PriceCents,
+		Currency:    currency,
+		SuccessURL:  base + "/?payment=success",
+		CancelURL:   base + "/payment/cancel?token=" + url.QueryEscape(cancelToken),
+		ExpiresAt:   holdExpiresAt,
+		Locale:      signup.Language,
+	})
+	if err != nil {
+		log.Printf("Error creating Stripe checkout session: %v", err)
+
+		// Give the seat back right away instead of waiting for the hold to expire
+		h.db.Exec("UPDATE signups SET status = 'expired' WHERE id = ?", signup.ID)
+		releaseCourseHolds(h.db, signup.ID)
+		return "", err
+	}
+
+	_, err = h.db.Exec("UPDATE signups SET stripe_session_id = ? WHERE id = ?", session.ID, signup.ID)
+	if err != nil {
+		log.Printf("Error saving Stripe session for signup %d: %v", signup.ID, err)
+	}
+
+	return session.URL, nil
+}
+
+// CheckoutCancelHandler is where Stripe sends people who go back from the
+// payment page. Their seat is given back right away rather than when the
+// hold runs out.
+func (h *Handlers) CheckoutCancelHandler(c *gin.Context) {
+	payload, ok := verifyToken(h.signingKey, checkoutCancelPurpose, c.Query("token"))
+	signupID, err := strconv.Atoi(payload)
+	if !ok || err != nil {
+		c.Redirect(http.StatusSeeOther, "/?payment=cancelled")
+		return
+	}
+
+	var sessionID sql.NullString
+	err = h.db.QueryRow(`
+        UPDATE signups SET status = 'expired'
+        WHERE id = ? AND status = 'pending_payment'
+        RETURNING stripe_session_id
+    `, signupID).Scan(&sessionID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error releasing hold of signup %d: %v", signupID, err)
+	}
+	if err == nil {
+		if err := releaseCourseHolds(h.db, signupID); err != nil {
+			log.Printf("Error releasing course holds of signup %d: %v", signupID, err)
+		}
+	}
+
+	// Otherwise the back button could still lead to paying for the seat
+	if sessionID.Valid && h.stripe != nil {
+		if err := h.stripe.ExpireCheckoutSession(sessionID.String); err != nil {
+			log.Printf("Error expiring Stripe session %s: %v", sessionID.String, err)
+		}
+	}
+
+	c.Redirect(http.StatusSeeOther, "/?payment=cancelled")
+}
+
+func (h *Handlers) StripeWebhookHandler(c *gin.Context) {
+	if h.stripe == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	payload, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read body"})
+		return
+	}
+
+	if err := h.stripe.VerifyWebhook(payload, c.GetHeader("Stripe-Signature")); err != nil {
+		log.Printf("Rejected Stripe webhook: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	var session checkoutSession
+	if strings.HasPrefix(event.Type, "checkout.session.") {
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checkout session"})
+			return
+		}
+	}
+
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		// Delayed payment methods complete the session before the money arrives
+		if session.PaymentStatus != "paid" {
+			break
+		}
+		if err := h.confirmPaidSignup(c, session); err != nil {
+			log.Printf("Error confirming paid signup for session %s: %v", session.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming signup"})
+			return
+		}
+	case "checkout.session.expired", "checkout.session.async_payment_failed":
+		paymentStatus := PaymentPending
+		if event.Type == "checkout.session.async_payment_failed" {
+			paymentStatus = PaymentFailed
+		}
+		var signupID int
+		err := h.db.QueryRow(`
+            UPDATE signups SET status = 'expired', payment_status = ?
+            WHERE stripe_session_id = ? AND status = 'pending_payment'
+            RETURNING id
+        `, paymentStatus, session.ID).Scan(&signupID)
+		if err == nil {
+			err = releaseCourseHolds(h.db, signupID)
+		}
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error releasing hold for session %s: %v", session.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error releasing seat"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// confirmPaidSignup confirms the seat and sends the emails. Stripe retries
+// webhooks, so this only acts on the first delivery.
+func (h *Handlers) confirmPaidSignup(c *gin.Context, session checkoutSession) error {
+	signupID, err := strconv.Atoi(session.ClientReferenceID)
+	if err != nil {
+		return fmt.Errorf("invalid client_reference_id %q", session.ClientReferenceID)
+	}
+
+	// The transaction takes the write lock up front, so nobody can book the
+	// seat between the capacity check and the update
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The session id may not be stored yet if the webhook beats our redirect
+	var status, paymentStatus string
+	var holding bool
+	err = tx.QueryRow(`
+        SELECT status, payment_status, status = 'pending_payment' AND hold_expires_at > datetime('now')
+        FROM signups
+        WHERE id = ? AND (stripe_session_id = ? OR stripe_session_id IS NULL)
+    `, signupID, session.ID).Scan(&status, &paymentStatus, &holding)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Already handled, either confirmed or flagged for a refund
+	if status == SignupConfirmed || paymentStatus == PaymentPaid {
+		return nil
+	}
+	if status != SignupPendingPayment && status != SignupExpired {
+		return nil
+	}
+
+	// A payment that arrives after the hold ran out only gets the seat if it's
+	// still free, in every session for a course. Otherwise the money is
+	// recorded and the admin refunds it.
+	if !holding {
+		fits, err := seatsStillFree(tx, signupID)
+		if err != nil {
+			return err
+		}
+		if !fits {
+			_, err = tx.Exec(`
+                UPDATE signups SET status = 'expired', hold_expires_at = NULL, stripe_session_id = ?,
+                                   payment_status = 'paid', amount_paid_cents = ?, payment_method = 'stripe',
+                                   refund_due = 1
+                WHERE id = ?
+            `, session.ID, session.AmountTotal, signupID)
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err == nil {
+				log.Printf("⚠️  Payment for signup %d arrived after its seat was taken, refund due", signupID)
+			}
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+        UPDATE signups SET status = 'confirmed', hold_expires_at = NULL, stripe_session_id = ?,
+                           payment_status = 'paid', amount_paid_cents = ?, payment_method = 'stripe'
+        WHERE id = ?
+    `, session.ID, session.AmountTotal, signupID)
+	if err != nil {
+		return err
+	}
+	// The other sessions of a course were held along with this one
+	_, err = tx.Exec(`
+        UPDATE signups SET status = 'confirmed', hold_expires_at = NULL
+        WHERE course_enrollment_id = (SELECT course_enrollment_id FROM signups WHERE id = ?) AND id != ?
+    `, signupID, signupID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	var signup Signup
+	var workshop Workshop
+	err = h.db.QueryRow(`
+        SELECT s.id, s.workshop_id, s.first_name, s.last_name, s.email, s.phone, s.status, s.seats,
+               COALESCE(s.language, ''), s.created_at, w.title, w.date, w.location, COALESCE(w.starts_at, ''),
+               COALESCE(w.course_id, 0)
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.id = ?
+    `, signupID).Scan(&signup.ID, &signup.WorkshopID, &signup.FirstName, &signup.LastName,
+		&signup.Email, &signup.Phone, &signup.Status, &signup.Seats, &signup.Language, &signup.CreatedAt,
+		&workshop.Title, &workshop.Date, &workshop.Location, &workshop.StartsAt, &workshop.CourseID)
+	if err != nil {
+		return err
+	}
+	workshop.ID = signup.WorkshopID
+
+	guests, err := h.loadGuests("s.id = ?", signup.ID)
+	if err != nil {
+		return err
+	}
+	signup.Guests = guests[signup.ID]
+
+	log.Printf("✓ Payment received for signup %d", signup.ID)
+
+	// Course participants get one email listing all sessions
+	if workshop.CourseID != 0 {
+		course, err := loadCourse(h.db, workshop.CourseID)
+		if err != nil {
+			return err
+		}
+		h.sendCourseEmails(c, signup, course)
+		return nil
+	}
+	h.sendSignupEmails(c, signup, workshop)
+	return nil
+}
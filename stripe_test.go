@@ -0,0 +1,493 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// fakeStripe stands in for the Checkout endpoints of the Stripe API
+type fakeStripe struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	created  []url.Values
+	headers  []http.Header
+	expired  []string
+	failWith int // answer session creation with this status instead
+}
+
+func newFakeStripe(t *testing.T) *fakeStripe {
+	f := &fakeStripe{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/checkout/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); user != "sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.failWith != 0 {
+			w.WriteHeader(f.failWith)
+			fmt.Fprint(w, `{"error": {"message": "amount too small"}}`)
+			return
+		}
+		f.created = append(f.created, r.PostForm)
+		f.headers = append(f.headers, r.Header.Clone())
+		id := fmt.Sprintf("cs_test_%d", len(f.created))
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "url": "https://checkout.test/" + id})
+	})
+	mux.HandleFunc("POST /v1/checkout/sessions/{id}/expire", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.expired = append(f.expired, r.PathValue("id"))
+		fmt.Fprintf(w, `{"id": %q, "status": "expired"}`, r.PathValue("id"))
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// newTestHandlers sets up a fresh database in a temporary directory and
+// handlers that talk to the fake Stripe
+func newTestHandlers(t *testing.T, stripe *fakeStripe) (*Handlers, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	t.Setenv("SMTP_HOST", "")
+
+	db := initDB()
+	t.Cleanup(func() { db.Close() })
+
+	h := &Handlers{
+		db:           db,
+		holdDuration: minHoldDuration,
+		signingKey:   []byte("test signing key"),
+		spam:         newSpamGuardFromEnv(),
+		stripe: &StripeClient{
+			apiBase:       stripe.URL,
+			secretKey:     "sk_test",
+			webhookSecret: testWebhookSecret,
+			httpClient:    stripe.Client(),
+		},
+	}
+
+	r := gin.New()
+	r.POST("/stripe/webhook", h.StripeWebhookHandler)
+	r.GET("/payment/cancel", h.CheckoutCancelHandler)
+	return h, r
+}
+
+// createPaidWorkshop adds a workshop with the given capacity and a signup
+// holding one seat while it's paid through session cs_test_1
+func createPaidWorkshop(t *testing.T, db *sql.DB, capacity int, holdUntil time.Time) (workshopID, signupID int) {
+	id, err := insertWorkshop(db, Workshop{
+		Title:       "Sound Healing",
+		Location:    "Zurich",
+		MaxCapacity: capacity,
+		PriceCents:  4500,
+		Currency:    "CHF",
+	}, time.Now().Add(7*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	workshopID = int(id)
+	signupID = insertSignup(t, db, workshopID, "pending_payment", holdUntil)
+	if _, err := db.Exec("UPDATE signups SET stripe_session_id = 'cs_test_1' WHERE id = ?", signupID); err != nil {
+		t.Fatal(err)
+	}
+	return workshopID, signupID
+}
+
+func insertSignup(t *testing.T, db *sql.DB, workshopID int, status string, holdUntil time.Time) int {
+	var hold any
+	if !holdUntil.IsZero() {
+		hold = holdUntil.UTC().Format(sqliteTimeLayout)
+	}
+	result, err := db.Exec(`
+        INSERT INTO signups (workshop_id, first_name, last_name, email, phone, status, hold_expires_at,
+                             price_cents, language)
+        VALUES (?, 'Anna', 'Muster', 'anna@example.com', '+41791234567', ?, ?, 4500, 'en')
+    `, workshopID, status, hold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+// signedWebhook builds a Stripe-Signature header for payload as Stripe does
+func signedWebhook(secret string, timestamp time.Time, payload []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func sessionEvent(eventType string, signupID int, paymentStatus string) []byte {
+	payload, _ := json.Marshal(map[string]any{
+		"id":   "evt_" + eventType,
+		"type": eventType,
+		"data": map[string]any{"object": map[string]any{
+			"id":                  "cs_test_1",
+			"payment_status":      paymentStatus,
+			"client_reference_id": strconv.Itoa(signupID),
+			"amount_total":        4500,
+			"currency":            "chf",
+		}},
+	})
+	return payload
+}
+
+func postWebhook(r *gin.Engine, payload []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/stripe/webhook", strings.NewReader(string(payload)))
+	req.Header.Set("Stripe-Signature", signature)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type signupState struct {
+	Status        string
+	PaymentStatus string
+	AmountPaid    int
+	RefundDue     bool
+}
+
+func loadSignupState(t *testing.T, db *sql.DB, signupID int) signupState {
+	var s signupState
+	err := db.QueryRow(`
+        SELECT status, payment_status, amount_paid_cents, refund_due FROM signups WHERE id = ?
+    `, signupID).Scan(&s.Status, &s.PaymentStatus, &s.AmountPaid, &s.RefundDue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCreateCheckoutSession(t *testing.T) {
+	fake := newFakeStripe(t)
+	h, _ := newTestHandlers(t, fake)
+
+	session, err := h.stripe.CreateCheckoutSession(checkoutParams{
+		SignupID:    7,
+		Email:       "anna@example.com",
+		Title:       "Sound Healing",
+		AmountCents: 4500,
+		Currency:    "CHF",
+		SuccessURL:  "https://example.com/?payment=success",
+		CancelURL:   "https://example.com/payment/cancel",
+		ExpiresAt:   time.Unix(1900000000, 0),
+		Locale:      "de",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.ID != "cs_test_1" || session.URL != "https://checkout.test/cs_test_1" {
+		t.Errorf("got session %+v", session)
+	}
+
+	form := fake.created[0]
+	want := map[string]string{
+		"mode":                                   "payment",
+		"client_reference_id":                    "7",
+		"customer_email":                         "anna@example.com",
+		"expires_at":                             "1900000000",
+		"line_items[0][price_data][currency]":    "chf",
+		"line_items[0][price_data][unit_amount]": "4500",
+		"line_items[0][price_data][product_data][name]": "Sound Healing",
+		"locale": "de",
+	}
+	for key, value := range want {
+		if got := form.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if got := fake.headers[0].Get("Idempotency-Key"); got != "checkout-signup-7" {
+		t.Errorf("Idempotency-Key = %q", got)
+	}
+}
+
+func TestCreateCheckoutSessionError(t *testing.T) {
+	fake := newFakeStripe(t)
+	fake.failWith = http.StatusBadRequest
+	h, _ := newTestHandlers(t, fake)
+
+	_, err := h.stripe.CreateCheckoutSession(checkoutParams{SignupID: 1, Currency: "CHF", AmountCents: 10})
+	if err == nil || !strings.Contains(err.Error(), "amount too small") {
+		t.Fatalf("got error %v, want Stripe's message", err)
+	}
+}
+
+func TestWebhookConfirmsHeldSeat(t *testing.T) {
+	h, r := newTestHandlers(t, newFakeStripe(t))
+	_, signupID := createPaidWorkshop(t, h.db, 10, time.Now().Add(20*time.Minute))
+
+	payload := sessionEvent("checkout.session.completed", signupID, "paid")
+	w := postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	got := loadSignupState(t, h.db, signupID)
+	want := signupState{Status: SignupConfirmed, PaymentStatus: PaymentPaid, AmountPaid: 4500}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhookRejectsBadSignatures(t *testing.T) {
+	h, r := newTestHandlers(t, newFakeStripe(t))
+	_, signupID := createPaidWorkshop(t, h.db, 10, time.Now().Add(20*time.Minute))
+	payload := sessionEvent("checkout.session.completed", signupID, "paid")
+
+	tests := map[string]string{
+		"missing":      "",
+		"wrong secret": signedWebhook("whsec_other", time.Now(), payload),
+		"stale":        signedWebhook(testWebhookSecret, time.Now().Add(-10*time.Minute), payload),
+		"tampered":     signedWebhook(testWebhookSecret, time.Now(), append([]byte(" "), payload...)),
+	}
+	for name, signature := range tests {
+		t.Run(name, func(t *testing.T) {
+			if w := postWebhook(r, payload, signature); w.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400", w.Code)
+			}
+			if got := loadSignupState(t, h.db, signupID); got.Status != SignupPendingPayment {
+				t.Errorf("signup is %s, want it still held", got.Status)
+			}
+		})
+	}
+}
+
+func TestWebhookRepeatedEventIsNoOp(t *testing.T) {
+	h, r := newTestHandlers(t, newFakeStripe(t))
+	_, signupID := createPaidWorkshop(t, h.db, 10, time.Now().Add(20*time.Minute))
+	payload := sessionEvent("checkout.session.completed", signupID, "paid")
+
+	if w := postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload)); w.Code != http.StatusOK {
+		t.Fatalf("first delivery: status %d", w.Code)
+	}
+	// An admin correcting the payment afterwards must not be overwritten
+	if _, err := h.db.Exec("UPDATE signups SET amount_paid_cents = 4000 WHERE id = ?", signupID); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload)); w.Code != http.StatusOK {
+		t.Fatalf("second delivery: status %d", w.Code)
+	}
+	if got := loadSignupState(t, h.db, signupID); got.AmountPaid != 4000 || got.Status != SignupConfirmed {
+		t.Errorf("repeated event changed the signup: %+v", got)
+	}
+}
+
+func TestWebhookExpiredSessionReleasesSeat(t *testing.T) {
+	h, r := newTestHandlers(t, newFakeStripe(t))
+	workshopID, signupID := createPaidWorkshop(t, h.db, 1, time.Now().Add(20*time.Minute))
+
+	payload := sessionEvent("checkout.session.expired", signupID, "unpaid")
+	if w := postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload)); w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+
+	if got := loadSignupState(t, h.db, signupID); got.Status != SignupExpired {
+		t.Errorf("signup is %s, want expired", got.Status)
+	}
+	if taken, _ := seatsTaken(h.db, workshopID); taken != 0 {
+		t.Errorf("%d seats taken, want the seat released", taken)
+	}
+}
+
+func TestWebhookLatePayment(t *testing.T) {
+	t.Run("seat still free", func(t *testing.T) {
+		h, r := newTestHandlers(t, newFakeStripe(t))
+		_, signupID := createPaidWorkshop(t, h.db, 1, time.Now().Add(-time.Minute))
+		expireHolds(h.db)
+
+		payload := sessionEvent("checkout.session.completed", signupID, "paid")
+		postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload))
+
+		if got := loadSignupState(t, h.db, signupID); got.Status != SignupConfirmed || got.RefundDue {
+			t.Errorf("got %+v, want confirmed", got)
+		}
+	})
+
+	t.Run("seat taken meanwhile", func(t *testing.T) {
+		h, r := newTestHandlers(t, newFakeStripe(t))
+		workshopID, signupID := createPaidWorkshop(t, h.db, 1, time.Now().Add(-time.Minute))
+		expireHolds(h.db)
+		insertSignup(t, h.db, workshopID, SignupConfirmed, time.Time{})
+
+		payload := sessionEvent("checkout.session.completed", signupID, "paid")
+		postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload))
+
+		got := loadSignupState(t, h.db, signupID)
+		want := signupState{Status: SignupExpired, PaymentStatus: PaymentPaid, AmountPaid: 4500, RefundDue: true}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+		if taken, _ := seatsTaken(h.db, workshopID); taken != 1 {
+			t.Errorf("%d seats taken, want the workshop not overbooked", taken)
+		}
+	})
+}
+
+func TestCheckoutCancelReleasesSeat(t *testing.T) {
+	fake := newFakeStripe(t)
+	h, r := newTestHandlers(t, fake)
+	workshopID, signupID := createPaidWorkshop(t, h.db, 1, time.Now().Add(20*time.Minute))
+
+	token := signToken(h.signingKey, checkoutCancelPurpose, strconv.Itoa(signupID))
+	req := httptest.NewRequest(http.MethodGet, "/payment/cancel?token="+url.QueryEscape(token), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?payment=cancelled" {
+		t.Errorf("got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if taken, _ := seatsTaken(h.db, workshopID); taken != 0 {
+		t.Errorf("%d seats taken, want the seat released", taken)
+	}
+	if len(fake.expired) != 1 || fake.expired[0] != "cs_test_1" {
+		t.Errorf("expired sessions %v, want cs_test_1", fake.expired)
+	}
+}
+
+// enrollInPaidCourse signs up for a course of two sessions through the form
+// and returns the signup of each session, the paying one first
+func enrollInPaidCourse(t *testing.T, h *Handlers, r *gin.Engine) []int {
+	result, err := h.db.Exec(`
+        INSERT INTO courses (title, location, max_capacity, price_cents, currency)
+        VALUES ('Yin Basics', 'Zurich', 8, 18000, 'CHF')
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	courseID, _ := result.LastInsertId()
+	for i := 1; i <= 2; i++ {
+		_, err := insertWorkshop(h.db, Workshop{
+			Title:       fmt.Sprintf("Yin Basics (Session %d/2)", i),
+			Location:    "Zurich",
+			MaxCapacity: 8,
+			Currency:    "CHF",
+			CourseID:    int(courseID),
+		}, time.Now().Add(time.Duration(i)*7*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	form := url.Values{
+		"first_name": {"Anna"},
+		"last_name":  {"Muster"},
+		"email":      {"anna@example.com"},
+		"form_token": {h.formToken()},
+	}
+	policies, err := h.consentPolicies(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range policies {
+		form.Set(fmt.Sprintf("consent_%d", p.ID), "true")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/courses/%d/signup", courseID),
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "https://checkout.test/cs_test_1" {
+		t.Fatalf("got %d to %q, want a redirect to Checkout", w.Code, w.Header().Get("Location"))
+	}
+
+	rows, err := h.db.Query("SELECT id FROM signups ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var signupIDs []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		signupIDs = append(signupIDs, id)
+	}
+	if len(signupIDs) != 2 {
+		t.Fatalf("%d signups, want one per session", len(signupIDs))
+	}
+	return signupIDs
+}
+
+func TestCourseCheckout(t *testing.T) {
+	t.Setenv("SIGNUP_MIN_FILL_SECONDS", "0")
+
+	newCourseHandlers := func(t *testing.T) (*Handlers, *gin.Engine, *fakeStripe) {
+		fake := newFakeStripe(t)
+		h, r := newTestHandlers(t, fake)
+		r.POST("/courses/:id/signup", h.CourseSignupHandler)
+		return h, r, fake
+	}
+
+	t.Run("holds every session until paid", func(t *testing.T) {
+		h, r, fake := newCourseHandlers(t)
+		signupIDs := enrollInPaidCourse(t, h, r)
+
+		if got := fake.created[0].Get("line_items[0][price_data][unit_amount]"); got != "18000" {
+			t.Errorf("checkout for %s cents, want the course price", got)
+		}
+		if got := loadSignupState(t, h.db, signupIDs[0]); got.Status != SignupPendingPayment || got.PaymentStatus != PaymentPending {
+			t.Errorf("paying signup is %s/%s, want pending_payment/pending", got.Status, got.PaymentStatus)
+		}
+		if got := loadSignupState(t, h.db, signupIDs[1]); got.Status != SignupPendingPayment || got.PaymentStatus != PaymentPaid {
+			t.Errorf("other session is %s/%s, want pending_payment/paid", got.Status, got.PaymentStatus)
+		}
+
+		payload := sessionEvent("checkout.session.completed", signupIDs[0], "paid")
+		if w := postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload)); w.Code != http.StatusOK {
+			t.Fatalf("status %d", w.Code)
+		}
+		for _, id := range signupIDs {
+			if got := loadSignupState(t, h.db, id); got.Status != SignupConfirmed {
+				t.Errorf("signup %d is %s after payment, want confirmed", id, got.Status)
+			}
+		}
+	})
+
+	t.Run("expired session releases every session", func(t *testing.T) {
+		h, r, _ := newCourseHandlers(t)
+		signupIDs := enrollInPaidCourse(t, h, r)
+
+		payload := sessionEvent("checkout.session.expired", signupIDs[0], "unpaid")
+		if w := postWebhook(r, payload, signedWebhook(testWebhookSecret, time.Now(), payload)); w.Code != http.StatusOK {
+			t.Fatalf("status %d", w.Code)
+		}
+		for _, id := range signupIDs {
+			if got := loadSignupState(t, h.db, id); got.Status != SignupExpired {
+				t.Errorf("signup %d is %s, want expired", id, got.Status)
+			}
+		}
+
+		course, err := loadCourse(h.db, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if course.Enrolled != 0 {
+			t.Errorf("%d enrolled, want the expired enrollment not counted", course.Enrolled)
+		}
+	})
+}
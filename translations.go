@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkshopTranslation is a workshop's title and description in another
+// language. The workshop's own title and description are in the default
+// language and shown whenever a translation is missing.
+type WorkshopTranslation struct {
+	Language    string
+	Title       string
+	Description string
+}
+
+// LanguageName is the language's own name, e.g. Français
+func (t WorkshopTranslation) LanguageName() string {
+	return translate(t.Language, "language.name")
+}
+
+// translationLanguages are the languages admins can translate workshops into
+func translationLanguages() []string {
+	var languages []string
+	for _, lang := range supportedLanguages {
+		if lang != defaultLanguage() {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// translationsFromForm reads the title_<lang> and description_<lang> fields.
+// Languages left empty are skipped.
+func translationsFromForm(c *gin.Context) []WorkshopTranslation {
+	var translations []WorkshopTranslation
+	for _, lang := range translationLanguages() {
+		t := WorkshopTranslation{
+			Language:    lang,
+			Title:       strings.TrimSpace(c.PostForm("title_" + lang)),
+			Description: strings.TrimSpace(c.PostForm("description_" + lang)),
+		}
+		if t.Title != "" || t.Description != "" {
+			translations = append(translations, t)
+		}
+	}
+	return translations
+}
+
+// translationFields is one entry per translatable language for the admin
+// forms, filled in where a translation exists
+func translationFields(existing []WorkshopTranslation) []WorkshopTranslation {
+	var fields []WorkshopTranslation
+	for _, lang := range translationLanguages() {
+		field := WorkshopTranslation{Language: lang}
+		for _, t := range existing {
+			if t.Language == lang {
+				field = t
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// saveWorkshopTranslations replaces the workshop's translations
+func saveWorkshopTranslations(db execer, workshopID int64, translations []WorkshopTranslation) error {
+	if _, err := db.Exec("DELETE FROM workshop_translations WHERE workshop_id = ?", workshopID); err != nil {
+		return err
+	}
+	for _, t := range translations {
+		_, err := db.Exec(`
+            INSERT INTO workshop_translations (workshop_id, language, title, description)
+            VALUES (?, ?, ?, ?)
+        `, workshopID, t.Language, t.Title, t.Description)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handlers) workshopTranslations(workshopID int) ([]WorkshopTranslation, error) {
+	rows, err := h.db.Query(`
+        SELECT language, title, description FROM workshop_translations
+        WHERE workshop_id = ?
+    `, workshopID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var translations []WorkshopTranslation
+	for rows.Next() {
+		var t WorkshopTranslation
+		if err := rows.Scan(&t.Language, &t.Title, &t.Description); err != nil {
+			return nil, err
+		}
+		translations = append(translations, t)
+	}
+	return translations, rows.Err()
+}
+
+// localizeWorkshop switches the workshop's title and description to lang,
+// each falling back to the workshop's own text if not translated
+func (h *Handlers) localizeWorkshop(w *Workshop, lang string) {
+	if w.ID == 0 {
+		return
+	}
+	err := h.db.QueryRow(`
+        SELECT COALESCE(NULLIF(t.title, ''), w.title),
+               COALESCE(NULLIF(t.description, ''), w.description, '')
+        FROM workshops w
+        LEFT JOIN workshop_translations t ON t.workshop_id = w.id AND t.language = ?
+        WHERE w.id = ?
+    `, lang, w.ID).Scan(&w.Title, &w.Description)
+	if err != nil {
+		log.Printf("Error loading %s text of workshop %d: %v", lang, w.ID, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const signupVerifyPurpose = "verify-signup"
+
+// defaultVerifyDuration is how long a seat is held for someone to open the
+// link in the verification email
+const defaultVerifyDuration = time.Hour
+
+// verifyDurationFromEnv reads EMAIL_VERIFICATION_MINUTES
+func verifyDurationFromEnv() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("EMAIL_VERIFICATION_MINUTES"))
+	if err != nil || minutes < 1 {
+		return defaultVerifyDuration
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// sendVerificationEmail sends the link that confirms a signup of a workshop
+// with email verification on
+func (h *Handlers) sendVerificationEmail(c *gin.Context, signup Signup, workshop Workshop, expiresAt time.Time) {
+	token := signToken(h.signingKey, signupVerifyPurpose, strconv.Itoa(signup.ID))
+	verifyURL := fmt.Sprintf("%s/signup/verify?token=%s", baseURL(c), url.QueryEscape(token))
+
+	lang := signup.Language
+	h.localizeWorkshop(&workshop, lang)
+	minutes := int(time.Until(expiresAt).Round(time.Minute).Minutes())
+	subject := translate(lang, "email.verify.subject", workshop.Title)
+	body := translate(lang, "email.verify.body", signup.FirstName, workshop.Title,
+		workshopDate(workshop, lang), verifyURL, minutes)
+
+	// c is reused once the request is done, its request's context isn't
+	ctx := c.Request.Context()
+	go func() {
+		if err := sendEmail(signup.Email, subject, body, "", ""); err != nil {
+			slog.ErrorContext(ctx, "Sending verification email failed", "error", err, "signup_id", signup.ID)
+			return
+		}
+		slog.InfoContext(ctx, "Verification email sent", "signup_id", signup.ID)
+	}()
+}
+
+// VerifySignupHandler is the link in the verification email. It asks before
+// confirming on GET, so link scanners in mail filters don't use up the link
+// by visiting it. The POST confirms the held seat, or moves on to payment
+// for workshops paid online.
+func (h *Handlers) VerifySignupHandler(c *gin.Context) {
+	token := c.Query("token")
+	payload, ok := verifyToken(h.signingKey, signupVerifyPurpose, token)
+	signupID, err := strconv.Atoi(payload)
+	if !ok || err != nil {
+		c.Redirect(http.StatusSeeOther, "/?verify=invalid")
+		return
+	}
+
+	var signup Signup
+	var workshop Workshop
+	err = h.db.QueryRow(`
+        SELECT s.id, s.workshop_id, s.first_name, s.last_name, s.email, s.phone, s.status, s.seats,
+               s.price_cents, s.payment_status, COALESCE(s.language, ''), s.created_at,
+               w.title, w.date, w.location, w.currency, COALESCE(w.starts_at, '')
+        FROM signups s
+        JOIN workshops w ON w.id = s.workshop_id
+        WHERE s.id = ?
+    `, signupID).Scan(&signup.ID, &signup.WorkshopID, &signup.FirstName, &signup.LastName,
+		&signup.Email, &signup.Phone, &signup.Status, &signup.Seats, &signup.PriceCents,
+		&signup.PaymentStatus, &signup.Language, &signup.CreatedAt,
+		&workshop.Title, &workshop.Date, &workshop.Location, &workshop.Currency, &workshop.StartsAt)
+	if err != nil {
+		// Erased in the meantime
+		c.Redirect(http.StatusSeeOther, "/?verify=invalid")
+		return
+	}
+	workshop.ID = signup.WorkshopID
+	if signup.Language == "" {
+		signup.Language = defaultLanguage()
+	}
+
+	// Opening the link twice is fine
+	if signup.Status != SignupPendingVerification {
+		if signup.Status == SignupExpired {
+			c.Redirect(http.StatusSeeOther, "/?verify=expired")
+		} else {
+			c.Redirect(http.StatusSeeOther, "/?verify=done")
+		}
+		return
+	}
+
+	payOnline := signup.PriceCents > 0 && h.stripe != nil
+	status := SignupConfirmed
+	var holdExpiresAt time.Time
+	var holdUntil any
+	if payOnline {
+		status = SignupPendingPayment
+		holdExpiresAt = time.Now().UTC().Add(h.holdDuration)
+		holdUntil = holdExpiresAt.Format(sqliteTimeLayout)
+	}
+
+	if c.Request.Method == http.MethodGet {
+		h.localizeWorkshop(&workshop, signup.Language)
+		c.HTML(http.StatusOK, "verify_signup.html", gin.H{
+			"Lang":         signup.Language,
+			"Workshop":     workshop,
+			"WorkshopDate": workshopDate(workshop, signup.Language),
+			"Token":        token,
+			"PayOnline":    payOnline,
+		})
+		return
+	}
+
+	// Only a hold that's still running counts, after that the seat may have
+	// gone to someone else
+	result, err := h.db.Exec(`
+        UPDATE signups SET status = ?, hold_expires_at = ?
+        WHERE id = ? AND status = 'pending_verification' AND hold_expires_at > datetime('now')
+    `, status, holdUntil, signup.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Verifying signup failed", "error", err, "signup_id", signup.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming signup"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.Redirect(http.StatusSeeOther, "/?verify=expired")
+		return
+	}
+	signup.Status = status
+	slog.InfoContext(c, "Email verified", "signup_id", signup.ID)
+
+	guests, err := h.loadGuests("s.id = ?", signup.ID)
+	if err != nil {
+		slog.ErrorContext(c, "Loading guests failed", "error", err)
+	}
+	signup.Guests = guests[signup.ID]
+
+	if payOnline {
+		h.localizeWorkshop(&workshop, signup.Language)
+		if err := h.startCheckout(c, signup, workshop, holdExpiresAt); err != nil {
+			c.Redirect(http.StatusSeeOther, "/?payment=failed")
+		}
+		return
+	}
+
+	h.sendSignupEmails(c, signup, workshop)
+	c.Redirect(http.StatusSeeOther, "/?success=true")
+}